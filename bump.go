@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// BumpParts are the parts of the version, which can be increased
+var BumpParts = []string{"major", "minor", "patch", "prerelease"}
+
+// BumpCommand calculates the next version of the resolved one and optionally writes it back to the source
+// F.e. mkver bump minor => 1.3.0 (version 1.2.3), mkver bump prerelease => 1.2.3-rc.5 (version 1.2.3-rc.4)
+var BumpCommand = cli.Command{
+	Name:      "bump",
+	Usage:     "Print the next version, increasing the part of the resolved one",
+	ArgsUsage: strings.Join(BumpParts, "|"),
+	Flags: []cli.Flag{
+		PreidFlag,
+		WriteFlag,
+		DryRunFlag,
+	},
+	Action: func(ctx *cli.Context) {
+		// Source flags, f.e. --gradle, are global ones and precede the command
+		config, err := configure(*ctx.Parent())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		version, source, err := resolveVersion(&config)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		next, err := bumpVersion(version, ctx.Args().First(), ctx.String(PreidFlag.Name))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if ctx.Bool(WriteFlag.Name) {
+			config.dryRun = config.dryRun || ctx.Bool(DryRunFlag.Name)
+			if err := writeVersion(&config, source, next, os.Stderr); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		fmt.Printf("%s", next)
+	},
+}
+
+// Increases the part of the version. With the preid, major, minor and patch produce the first prerelease
+// of the next version, f.e. 1.2.3 => 2.0.0-rc.0 (major, preid rc). Build metadata is dropped.
+// The next version always has higher precedence than the current one.
+func bumpVersion(version string, part string, preid string) (string, error) {
+	current, err := ParseSemVerLenient(version)
+	if err != nil {
+		return "", err
+	}
+
+	release := current
+	if len(preid) > 0 {
+		release.Prerelease = nil
+	}
+
+	var next SemVer
+	switch part {
+	case "major":
+		next = release.IncMajor()
+	case "minor":
+		next = release.IncMinor()
+	case "patch":
+		next = release.IncPatch()
+	case "prerelease":
+		next = current.IncPrerelease(preid)
+	default:
+		return "", fmt.Errorf("Unknown version part %q, expected one of: %s", part, strings.Join(BumpParts, ", "))
+	}
+	if len(preid) > 0 && part != "prerelease" {
+		next.Prerelease = prereleaseOf(preid)
+	}
+
+	if next.Compare(current) <= 0 {
+		return "", fmt.Errorf("Next version %s has no higher precedence than %s", next, current)
+	}
+	return next.String(), nil
+}
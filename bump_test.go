@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+var BumpTests = []struct {
+	version  string
+	part     string
+	preid    string
+	expected string
+	err      string
+}{
+	{"1.2.3", "major", "", "2.0.0", ""},
+	{"1.2.3", "minor", "", "1.3.0", ""},
+	{"1.2.3", "patch", "", "1.2.4", ""},
+	{"1.2.3+git.1a2b3c", "patch", "", "1.2.4", ""},
+	{"1.2.4-rc.1", "patch", "", "1.2.4", ""},
+	{"2.0.0-rc.1", "major", "", "2.0.0", ""},
+	{"1.2.3", "prerelease", "", "1.2.4-0", ""},
+	{"1.2.3", "prerelease", "rc", "1.2.4-rc.0", ""},
+	{"1.2.3-rc.4", "prerelease", "", "1.2.3-rc.5", ""},
+	{"1.2.3-rc.4", "prerelease", "rc", "1.2.3-rc.5", ""},
+	{"1.2.3-rc.4.beta", "prerelease", "", "1.2.3-rc.5.beta", ""},
+	{"1.2.3-alpha.2", "prerelease", "beta", "1.2.3-beta.0", ""},
+	{"1.2.3-SNAPSHOT", "prerelease", "", "1.2.3-SNAPSHOT.0", ""},
+	{"1.2.3", "major", "rc", "2.0.0-rc.0", ""},
+	{"2.0.0-rc.1", "major", "rc", "3.0.0-rc.0", ""},
+	{"1.2.3", "minor", "rc", "1.3.0-rc.0", ""},
+	{"1.2.3", "patch", "rc", "1.2.4-rc.0", ""},
+	{"v1.2", "minor", "", "1.3.0", ""},
+	{"1.2.3-rc.4", "prerelease", "alpha", "", "Next version 1.2.3-alpha.0 has no higher precedence than 1.2.3-rc.4"},
+	{"1.2.3", "build", "", "", "Unknown version part \"build\", expected one of: major, minor, patch, prerelease"},
+	{"1.2.3", "", "", "", "Unknown version part \"\""},
+	{"latest", "patch", "", "", "Invalid semantic version \"latest\""},
+}
+
+func TestBump(t *testing.T) {
+	for _, test := range BumpTests {
+		name := test.version + " " + test.part + " " + test.preid
+		got, err := bumpVersion(test.version, test.part, test.preid)
+		if len(test.err) > 0 {
+			assert.ErrorContains(t, err, test.err, "failed while testing "+name)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+name)
+		assert.Equal(t, test.expected, got, "failed while testing "+name)
+	}
+}
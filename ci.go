@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BuildInfo describes the build as reported by the CI system
+type BuildInfo struct {
+	Provider       string // Name of the CI provider, f.e. "github"
+	Branch         string // Branch being built, the source branch for pull requests
+	Tag            string // Tag being built, if any
+	PrNumber       string // Number of the pull request being built, if any
+	PrTargetBranch string // Branch the pull request is going to be merged into
+	BuildNumber    string
+	Sha            string // Sha of the commit being built, if reported by CI
+}
+
+// CIProvider reports the build info from the environment of the CI system
+type CIProvider interface {
+	// Name of the provider, f.e. "github"
+	Name() string
+	// Detect reports whether the build is running on the CI system
+	Detect() bool
+	// BuildInfo collects the build info from the environment
+	BuildInfo() BuildInfo
+}
+
+// CIProviders contains the registered providers by their names
+var CIProviders = map[string]CIProvider{}
+
+// CIDetectionOrder is the order providers are detected in.
+// More specific providers go first, f.e. TeamCity sets $BUILD_NUMBER just like Jenkins.
+var CIDetectionOrder = []string{"github", "gitlab", "azure", "circleci", "bitbucket", "teamcity", "buildkite", "travis", "drone", "jenkins"}
+
+// RegisterCIProvider makes the provider available for the detection
+func RegisterCIProvider(provider CIProvider) {
+	CIProviders[provider.Name()] = provider
+}
+
+func init() {
+	RegisterCIProvider(jenkinsProvider{})
+	RegisterCIProvider(githubProvider{})
+	RegisterCIProvider(gitlabProvider{})
+	RegisterCIProvider(azureProvider{})
+	RegisterCIProvider(circleCIProvider{})
+	RegisterCIProvider(bitbucketProvider{})
+	RegisterCIProvider(teamCityProvider{})
+	RegisterCIProvider(buildkiteProvider{})
+	RegisterCIProvider(travisProvider{})
+	RegisterCIProvider(droneProvider{})
+}
+
+// Collects the build info from the CI provider, either forced with "--ci" or detected from the environment.
+// Returns false, if the build is not running on any of the known CI systems.
+func resolveBuildInfo(cfg *Config) (BuildInfo, bool) {
+	var provider CIProvider
+	if len(cfg.ci) > 0 {
+		provider = CIProviders[cfg.ci]
+	} else {
+		for _, name := range CIDetectionOrder {
+			if CIProviders[name].Detect() {
+				provider = CIProviders[name]
+				break
+			}
+		}
+	}
+	if provider == nil {
+		return BuildInfo{}, false
+	}
+
+	info := provider.BuildInfo()
+	info.Provider = provider.Name()
+	return info, true
+}
+
+func validateCI(name string) error {
+	if _, found := CIProviders[name]; len(name) > 0 && !found {
+		return fmt.Errorf("Unknown CI provider %q, available providers: %s", name, strings.Join(ciProviderNames(), ", "))
+	}
+	return nil
+}
+
+func ciProviderNames() []string {
+	names := make([]string, 0, len(CIProviders))
+	for name := range CIProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Splits the full ref into the branch, the tag or the pull request number:
+// refs/heads/<branch>, refs/tags/<tag> or refs/pull/<number>/merge
+func parseRef(ref string) (string, string, string) {
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		return strings.TrimPrefix(ref, "refs/heads/"), "", ""
+	case strings.HasPrefix(ref, "refs/tags/"):
+		return "", strings.TrimPrefix(ref, "refs/tags/"), ""
+	case strings.HasPrefix(ref, "refs/pull/"):
+		return "", "", strings.Split(strings.TrimPrefix(ref, "refs/pull/"), "/")[0]
+	}
+	return ref, "", ""
+}
+
+// Returns the pull request number, treating "false" as not a pull request (Travis, Buildkite)
+func prNumberOf(value string) string {
+	if value == "false" {
+		return ""
+	}
+	return value
+}
+
+//
+// JENKINS
+//
+
+type jenkinsProvider struct{}
+
+func (jenkinsProvider) Name() string {
+	return "jenkins"
+}
+
+func (jenkinsProvider) Detect() bool {
+	_, found := os.LookupEnv("BUILD_NUMBER") // magic jenkins variable
+	return found
+}
+
+func (jenkinsProvider) BuildInfo() BuildInfo {
+	info := BuildInfo{
+		Branch:      os.Getenv("BRANCH_NAME"),
+		Tag:         os.Getenv("TAG_NAME"),
+		BuildNumber: os.Getenv("BUILD_NUMBER"),
+		Sha:         os.Getenv("GIT_COMMIT"),
+	}
+
+	// Are we building a PR?
+	if id, found := os.LookupEnv("CHANGE_ID"); found {
+		info.Branch = os.Getenv("CHANGE_BRANCH")
+		info.PrNumber = id
+		info.PrTargetBranch = os.Getenv("CHANGE_TARGET")
+	}
+
+	// Tag builds set BRANCH_NAME to the tag name as well
+	if len(info.Tag) > 0 {
+		info.Branch = ""
+	}
+	return info
+}
+
+//
+// GITHUB ACTIONS
+//
+
+type githubProvider struct{}
+
+func (githubProvider) Name() string {
+	return "github"
+}
+
+func (githubProvider) Detect() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// GitHubEvent contains the fields of the GitHub Actions event payload used for versioning
+type GitHubEvent struct {
+	Number      int `json:"number"`
+	PullRequest struct {
+		Number int `json:"number"`
+	} `json:"pull_request"`
+}
+
+// BuildInfo reads GITHUB_REF, which is the branch, the tag or the pull request merge ref,
+// while GITHUB_HEAD_REF and GITHUB_BASE_REF are the source and target branches of the pull request.
+func (githubProvider) BuildInfo() BuildInfo {
+	info := BuildInfo{BuildNumber: os.Getenv("GITHUB_RUN_NUMBER"), Sha: os.Getenv("GITHUB_SHA")}
+	info.Branch, info.Tag, info.PrNumber = parseRef(os.Getenv("GITHUB_REF"))
+
+	// Pull requests check out the merge commit, the branch is the source one
+	if head := os.Getenv("GITHUB_HEAD_REF"); len(head) > 0 {
+		info.Branch = head
+		info.PrTargetBranch = os.Getenv("GITHUB_BASE_REF")
+
+		// pull_request_target builds the target branch, PR number is available in the event payload only
+		if event, err := readGitHubEvent(os.Getenv("GITHUB_EVENT_PATH")); err == nil && len(info.PrNumber) == 0 {
+			if event.PullRequest.Number > 0 {
+				info.PrNumber = strconv.Itoa(event.PullRequest.Number)
+			} else if event.Number > 0 {
+				info.PrNumber = strconv.Itoa(event.Number)
+			}
+		}
+	}
+	return info
+}
+
+func readGitHubEvent(path string) (GitHubEvent, error) {
+	var event GitHubEvent
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return event, err
+	}
+	err = json.Unmarshal(content, &event)
+	return event, err
+}
+
+//
+// GITLAB CI
+//
+
+type gitlabProvider struct{}
+
+func (gitlabProvider) Name() string {
+	return "gitlab"
+}
+
+func (gitlabProvider) Detect() bool {
+	return os.Getenv("GITLAB_CI") == "true"
+}
+
+// BuildInfo reads CI_COMMIT_REF_NAME, which is either the branch or the tag,
+// merge request pipelines report the source branch separately.
+func (gitlabProvider) BuildInfo() BuildInfo {
+	info := BuildInfo{
+		Tag:            os.Getenv("CI_COMMIT_TAG"),
+		PrNumber:       os.Getenv("CI_MERGE_REQUEST_IID"),
+		PrTargetBranch: os.Getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"),
+		BuildNumber:    os.Getenv("CI_PIPELINE_IID"),
+		Sha:            os.Getenv("CI_COMMIT_SHORT_SHA"),
+	}
+
+	if len(info.Tag) == 0 {
+		info.Branch = os.Getenv("CI_COMMIT_REF_NAME")
+	}
+	if source := os.Getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME"); len(source) > 0 {
+		info.Branch = source
+	}
+	return info
+}
+
+//
+// AZURE PIPELINES
+//
+
+type azureProvider struct{}
+
+func (azureProvider) Name() string {
+	return "azure"
+}
+
+func (azureProvider) Detect() bool {
+	return strings.EqualFold(os.Getenv("TF_BUILD"), "true")
+}
+
+// BuildInfo reads BUILD_SOURCEBRANCH, which is the full ref, pull requests report the source and target refs separately.
+// BUILD_BUILDID is used as the build number, as BUILD_BUILDNUMBER is a formatted string, f.e. 20191017.1
+func (azureProvider) BuildInfo() BuildInfo {
+	info := BuildInfo{BuildNumber: os.Getenv("BUILD_BUILDID"), Sha: os.Getenv("BUILD_SOURCEVERSION")}
+	info.Branch, info.Tag, info.PrNumber = parseRef(os.Getenv("BUILD_SOURCEBRANCH"))
+
+	if source := os.Getenv("SYSTEM_PULLREQUEST_SOURCEBRANCH"); len(source) > 0 {
+		info.Branch, _, _ = parseRef(source)
+		info.PrTargetBranch, _, _ = parseRef(os.Getenv("SYSTEM_PULLREQUEST_TARGETBRANCH"))
+
+		// GitHub repositories have both, the number is the one shown in the UI
+		info.PrNumber = os.Getenv("SYSTEM_PULLREQUEST_PULLREQUESTNUMBER")
+		if len(info.PrNumber) == 0 {
+			info.PrNumber = os.Getenv("SYSTEM_PULLREQUEST_PULLREQUESTID")
+		}
+	}
+	return info
+}
+
+//
+// CIRCLECI
+//
+
+type circleCIProvider struct{}
+
+func (circleCIProvider) Name() string {
+	return "circleci"
+}
+
+func (circleCIProvider) Detect() bool {
+	return os.Getenv("CIRCLECI") == "true"
+}
+
+// BuildInfo reads CIRCLE_BRANCH and CIRCLE_TAG. CIRCLE_PR_NUMBER is set for forked pull requests only,
+// otherwise the number is taken from CIRCLE_PULL_REQUEST url. CircleCI doesn't report the target branch.
+func (circleCIProvider) BuildInfo() BuildInfo {
+	info := BuildInfo{
+		Branch:      os.Getenv("CIRCLE_BRANCH"),
+		Tag:         os.Getenv("CIRCLE_TAG"),
+		PrNumber:    os.Getenv("CIRCLE_PR_NUMBER"),
+		BuildNumber: os.Getenv("CIRCLE_BUILD_NUM"),
+		Sha:         os.Getenv("CIRCLE_SHA1"),
+	}
+
+	if url := os.Getenv("CIRCLE_PULL_REQUEST"); len(info.PrNumber) == 0 && len(url) > 0 {
+		info.PrNumber = url[strings.LastIndex(url, "/")+1:]
+	}
+	return info
+}
+
+//
+// BITBUCKET PIPELINES
+//
+
+type bitbucketProvider struct{}
+
+func (bitbucketProvider) Name() string {
+	return "bitbucket"
+}
+
+func (bitbucketProvider) Detect() bool {
+	_, found := os.LookupEnv("BITBUCKET_BUILD_NUMBER")
+	return found
+}
+
+func (bitbucketProvider) BuildInfo() BuildInfo {
+	return BuildInfo{
+		Branch:         os.Getenv("BITBUCKET_BRANCH"),
+		Tag:            os.Getenv("BITBUCKET_TAG"),
+		PrNumber:       os.Getenv("BITBUCKET_PR_ID"),
+		PrTargetBranch: os.Getenv("BITBUCKET_PR_DESTINATION_BRANCH"),
+		BuildNumber:    os.Getenv("BITBUCKET_BUILD_NUMBER"),
+		Sha:            os.Getenv("BITBUCKET_COMMIT"),
+	}
+}
+
+//
+// TEAMCITY
+//
+
+type teamCityProvider struct{}
+
+func (teamCityProvider) Name() string {
+	return "teamcity"
+}
+
+func (teamCityProvider) Detect() bool {
+	_, found := os.LookupEnv("TEAMCITY_VERSION")
+	return found
+}
+
+// BuildInfo reads BUILD_NUMBER and BUILD_VCS_NUMBER. The branch and the pull request are not exported into env,
+// they're read from the configuration properties file referenced by TEAMCITY_BUILD_PROPERTIES_FILE.
+func (teamCityProvider) BuildInfo() BuildInfo {
+	info := BuildInfo{BuildNumber: os.Getenv("BUILD_NUMBER"), Sha: os.Getenv("BUILD_VCS_NUMBER")}
+
+	build := readPropertiesIfExists(os.Getenv("TEAMCITY_BUILD_PROPERTIES_FILE"))
+	configuration := readPropertiesIfExists(build["teamcity.configuration.properties.file"])
+
+	info.Branch, info.Tag, _ = parseRef(configuration["teamcity.build.branch"])
+	if source := configuration["teamcity.pullRequest.source.branch"]; len(source) > 0 {
+		info.Branch, _, _ = parseRef(source)
+		info.PrNumber = configuration["teamcity.pullRequest.number"]
+		info.PrTargetBranch, _, _ = parseRef(configuration["teamcity.pullRequest.target.branch"])
+	}
+	return info
+}
+
+// Reads the properties file, missing files have no properties
+func readPropertiesIfExists(filename string) map[string]string {
+	if _, err := os.Stat(filename); len(filename) == 0 || err != nil {
+		return map[string]string{}
+	}
+	properties, err := readPropertiesFile(filename)
+	if err != nil {
+		return map[string]string{}
+	}
+	return properties
+}
+
+//
+// BUILDKITE
+//
+
+type buildkiteProvider struct{}
+
+func (buildkiteProvider) Name() string {
+	return "buildkite"
+}
+
+func (buildkiteProvider) Detect() bool {
+	return os.Getenv("BUILDKITE") == "true"
+}
+
+func (buildkiteProvider) BuildInfo() BuildInfo {
+	info := BuildInfo{
+		Branch:      os.Getenv("BUILDKITE_BRANCH"),
+		Tag:         os.Getenv("BUILDKITE_TAG"),
+		PrNumber:    prNumberOf(os.Getenv("BUILDKITE_PULL_REQUEST")),
+		BuildNumber: os.Getenv("BUILDKITE_BUILD_NUMBER"),
+		Sha:         os.Getenv("BUILDKITE_COMMIT"),
+	}
+	if len(info.PrNumber) > 0 {
+		info.PrTargetBranch = os.Getenv("BUILDKITE_PULL_REQUEST_BASE_BRANCH")
+	}
+
+	// Tag builds set BUILDKITE_BRANCH to the tag name as well
+	if len(info.Tag) > 0 {
+		info.Branch = ""
+	}
+	return info
+}
+
+//
+// TRAVIS CI
+//
+
+type travisProvider struct{}
+
+func (travisProvider) Name() string {
+	return "travis"
+}
+
+func (travisProvider) Detect() bool {
+	return os.Getenv("TRAVIS") == "true"
+}
+
+// BuildInfo reads TRAVIS_BRANCH, which is the target branch for pull requests and the tag for tag builds
+func (travisProvider) BuildInfo() BuildInfo {
+	info := BuildInfo{
+		Tag:         os.Getenv("TRAVIS_TAG"),
+		PrNumber:    prNumberOf(os.Getenv("TRAVIS_PULL_REQUEST")),
+		BuildNumber: os.Getenv("TRAVIS_BUILD_NUMBER"),
+		Sha:         os.Getenv("TRAVIS_COMMIT"),
+	}
+
+	switch {
+	case len(info.PrNumber) > 0:
+		info.Branch = os.Getenv("TRAVIS_PULL_REQUEST_BRANCH")
+		info.PrTargetBranch = os.Getenv("TRAVIS_BRANCH")
+		info.Sha = os.Getenv("TRAVIS_PULL_REQUEST_SHA")
+	case len(info.Tag) == 0:
+		info.Branch = os.Getenv("TRAVIS_BRANCH")
+	}
+	return info
+}
+
+//
+// DRONE
+//
+
+type droneProvider struct{}
+
+func (droneProvider) Name() string {
+	return "drone"
+}
+
+func (droneProvider) Detect() bool {
+	return os.Getenv("DRONE") == "true"
+}
+
+// BuildInfo reads DRONE_BRANCH, which is the target branch for pull requests, the source one is DRONE_SOURCE_BRANCH
+func (droneProvider) BuildInfo() BuildInfo {
+	info := BuildInfo{
+		Tag:         os.Getenv("DRONE_TAG"),
+		PrNumber:    os.Getenv("DRONE_PULL_REQUEST"),
+		BuildNumber: os.Getenv("DRONE_BUILD_NUMBER"),
+		Sha:         os.Getenv("DRONE_COMMIT_SHA"),
+	}
+
+	switch {
+	case len(info.PrNumber) > 0:
+		info.Branch = os.Getenv("DRONE_SOURCE_BRANCH")
+		info.PrTargetBranch = os.Getenv("DRONE_TARGET_BRANCH")
+	case len(info.Tag) == 0:
+		info.Branch = os.Getenv("DRONE_BRANCH")
+	}
+	return info
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+// Variables of all supported CI systems, which are cleared before each test case
+var ciVariables = []string{
+	"BUILD_NUMBER", "BRANCH_NAME", "TAG_NAME", "CHANGE_ID", "CHANGE_BRANCH", "CHANGE_TARGET", "GIT_COMMIT",
+	"GITHUB_ACTIONS", "GITHUB_REF", "GITHUB_HEAD_REF", "GITHUB_BASE_REF", "GITHUB_RUN_NUMBER", "GITHUB_EVENT_PATH", "GITHUB_SHA",
+	"GITLAB_CI", "CI_COMMIT_REF_NAME", "CI_COMMIT_TAG", "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "CI_MERGE_REQUEST_TARGET_BRANCH_NAME",
+	"CI_MERGE_REQUEST_IID", "CI_PIPELINE_IID", "CI_COMMIT_SHORT_SHA",
+	"TF_BUILD", "BUILD_SOURCEBRANCH", "BUILD_BUILDID", "BUILD_SOURCEVERSION", "SYSTEM_PULLREQUEST_SOURCEBRANCH",
+	"SYSTEM_PULLREQUEST_TARGETBRANCH", "SYSTEM_PULLREQUEST_PULLREQUESTID", "SYSTEM_PULLREQUEST_PULLREQUESTNUMBER",
+	"CIRCLECI", "CIRCLE_BRANCH", "CIRCLE_TAG", "CIRCLE_PR_NUMBER", "CIRCLE_PULL_REQUEST", "CIRCLE_BUILD_NUM", "CIRCLE_SHA1",
+	"BITBUCKET_BUILD_NUMBER", "BITBUCKET_BRANCH", "BITBUCKET_TAG", "BITBUCKET_PR_ID", "BITBUCKET_PR_DESTINATION_BRANCH", "BITBUCKET_COMMIT",
+	"TEAMCITY_VERSION", "TEAMCITY_BUILD_PROPERTIES_FILE", "BUILD_VCS_NUMBER",
+	"BUILDKITE", "BUILDKITE_BRANCH", "BUILDKITE_TAG", "BUILDKITE_PULL_REQUEST", "BUILDKITE_PULL_REQUEST_BASE_BRANCH",
+	"BUILDKITE_BUILD_NUMBER", "BUILDKITE_COMMIT",
+	"TRAVIS", "TRAVIS_BRANCH", "TRAVIS_TAG", "TRAVIS_PULL_REQUEST", "TRAVIS_PULL_REQUEST_BRANCH", "TRAVIS_PULL_REQUEST_SHA",
+	"TRAVIS_BUILD_NUMBER", "TRAVIS_COMMIT",
+	"DRONE", "DRONE_BRANCH", "DRONE_SOURCE_BRANCH", "DRONE_TARGET_BRANCH", "DRONE_TAG", "DRONE_PULL_REQUEST",
+	"DRONE_BUILD_NUMBER", "DRONE_COMMIT_SHA",
+}
+
+// Replaces CI variables with the given ones, returns the function restoring the original environment
+func setCIEnv(vars map[string]string) func() {
+	original := map[string]string{}
+	for _, name := range ciVariables {
+		if value, found := os.LookupEnv(name); found {
+			original[name] = value
+		}
+		os.Unsetenv(name)
+	}
+	for name, value := range vars {
+		os.Setenv(name, value)
+	}
+
+	return func() {
+		for _, name := range ciVariables {
+			os.Unsetenv(name)
+		}
+		for name, value := range original {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+func TestResolveBuildInfo(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	prEvent := filepath.Join(dir, "pull_request.json")
+	writeFile(t, prEvent, `{"action": "opened", "number": 42, "pull_request": {"number": 42, "head": {"ref": "feature/x"}}}`)
+	pushEvent := filepath.Join(dir, "push.json")
+	writeFile(t, pushEvent, `{"ref": "refs/heads/main"}`)
+
+	teamCityBuild := filepath.Join(dir, "teamcity", "build.properties")
+	teamCityConfig := filepath.Join(dir, "teamcity", "config.properties")
+	writeFile(t, teamCityBuild, "teamcity.configuration.properties.file="+teamCityConfig+"\n")
+	writeFile(t, teamCityConfig, "teamcity.build.branch=pull/42\n"+
+		"teamcity.pullRequest.number=42\n"+
+		"teamcity.pullRequest.source.branch=refs/heads/feature/x\n"+
+		"teamcity.pullRequest.target.branch=refs/heads/main\n")
+
+	var tests = []struct {
+		name     string
+		env      map[string]string
+		expected BuildInfo
+		found    bool
+	}{
+		{"local", map[string]string{}, BuildInfo{}, false},
+
+		// Jenkins
+		{"jenkins: branch", map[string]string{"BUILD_NUMBER": "13", "BRANCH_NAME": "develop", "GIT_COMMIT": "1a2b3c4d5e"},
+			BuildInfo{Provider: "jenkins", Branch: "develop", BuildNumber: "13", Sha: "1a2b3c4d5e"}, true},
+		{"jenkins: pull request", map[string]string{"BUILD_NUMBER": "13", "BRANCH_NAME": "PR-42", "CHANGE_ID": "42", "CHANGE_BRANCH": "feature/x", "CHANGE_TARGET": "main"},
+			BuildInfo{Provider: "jenkins", Branch: "feature/x", PrNumber: "42", PrTargetBranch: "main", BuildNumber: "13"}, true},
+		{"jenkins: tag", map[string]string{"BUILD_NUMBER": "13", "BRANCH_NAME": "v1.0.0", "TAG_NAME": "v1.0.0"},
+			BuildInfo{Provider: "jenkins", Tag: "v1.0.0", BuildNumber: "13"}, true},
+
+		// GitHub Actions
+		{"github: branch", map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/heads/feature/x", "GITHUB_RUN_NUMBER": "7", "GITHUB_EVENT_PATH": pushEvent, "GITHUB_SHA": "1a2b3c4d5e"},
+			BuildInfo{Provider: "github", Branch: "feature/x", BuildNumber: "7", Sha: "1a2b3c4d5e"}, true},
+		{"github: tag", map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/tags/v1.0.0", "GITHUB_RUN_NUMBER": "7"},
+			BuildInfo{Provider: "github", Tag: "v1.0.0", BuildNumber: "7"}, true},
+		{"github: pull request", map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/pull/42/merge", "GITHUB_HEAD_REF": "feature/x", "GITHUB_BASE_REF": "main", "GITHUB_RUN_NUMBER": "7"},
+			BuildInfo{Provider: "github", Branch: "feature/x", PrNumber: "42", PrTargetBranch: "main", BuildNumber: "7"}, true},
+		{"github: pull request target", map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/heads/main", "GITHUB_HEAD_REF": "feature/x", "GITHUB_BASE_REF": "main", "GITHUB_RUN_NUMBER": "7", "GITHUB_EVENT_PATH": prEvent},
+			BuildInfo{Provider: "github", Branch: "feature/x", PrNumber: "42", PrTargetBranch: "main", BuildNumber: "7"}, true},
+		{"github: missing event payload", map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/heads/main", "GITHUB_HEAD_REF": "feature/x", "GITHUB_EVENT_PATH": filepath.Join(dir, "missing.json")},
+			BuildInfo{Provider: "github", Branch: "feature/x"}, true},
+
+		// GitLab CI
+		{"gitlab: branch", map[string]string{"GITLAB_CI": "true", "CI_COMMIT_REF_NAME": "develop", "CI_PIPELINE_IID": "21", "CI_COMMIT_SHORT_SHA": "1a2b3c4d"},
+			BuildInfo{Provider: "gitlab", Branch: "develop", BuildNumber: "21", Sha: "1a2b3c4d"}, true},
+		{"gitlab: tag", map[string]string{"GITLAB_CI": "true", "CI_COMMIT_REF_NAME": "v1.0.0", "CI_COMMIT_TAG": "v1.0.0", "CI_PIPELINE_IID": "21"},
+			BuildInfo{Provider: "gitlab", Tag: "v1.0.0", BuildNumber: "21"}, true},
+		{"gitlab: merge request", map[string]string{"GITLAB_CI": "true", "CI_COMMIT_REF_NAME": "feature/x", "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME": "feature/x", "CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "main", "CI_MERGE_REQUEST_IID": "5", "CI_PIPELINE_IID": "21"},
+			BuildInfo{Provider: "gitlab", Branch: "feature/x", PrNumber: "5", PrTargetBranch: "main", BuildNumber: "21"}, true},
+		{"gitlab: merged results pipeline", map[string]string{"GITLAB_CI": "true", "CI_COMMIT_REF_NAME": "refs/merge-requests/5/merge", "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME": "feature/x", "CI_MERGE_REQUEST_IID": "5"},
+			BuildInfo{Provider: "gitlab", Branch: "feature/x", PrNumber: "5"}, true},
+
+		// Azure Pipelines
+		{"azure: branch", map[string]string{"TF_BUILD": "True", "BUILD_SOURCEBRANCH": "refs/heads/feature/x", "BUILD_BUILDID": "311", "BUILD_SOURCEVERSION": "1a2b3c4d5e"},
+			BuildInfo{Provider: "azure", Branch: "feature/x", BuildNumber: "311", Sha: "1a2b3c4d5e"}, true},
+		{"azure: tag", map[string]string{"TF_BUILD": "True", "BUILD_SOURCEBRANCH": "refs/tags/v1.0.0", "BUILD_BUILDID": "311"},
+			BuildInfo{Provider: "azure", Tag: "v1.0.0", BuildNumber: "311"}, true},
+		{"azure: pull request", map[string]string{"TF_BUILD": "True", "BUILD_SOURCEBRANCH": "refs/pull/42/merge", "BUILD_BUILDID": "311",
+			"SYSTEM_PULLREQUEST_SOURCEBRANCH": "refs/heads/feature/x", "SYSTEM_PULLREQUEST_TARGETBRANCH": "refs/heads/main", "SYSTEM_PULLREQUEST_PULLREQUESTID": "42"},
+			BuildInfo{Provider: "azure", Branch: "feature/x", PrNumber: "42", PrTargetBranch: "main", BuildNumber: "311"}, true},
+
+		// CircleCI
+		{"circleci: branch", map[string]string{"CIRCLECI": "true", "CIRCLE_BRANCH": "feature/x", "CIRCLE_BUILD_NUM": "55", "CIRCLE_SHA1": "1a2b3c4d5e"},
+			BuildInfo{Provider: "circleci", Branch: "feature/x", BuildNumber: "55", Sha: "1a2b3c4d5e"}, true},
+		{"circleci: pull request", map[string]string{"CIRCLECI": "true", "CIRCLE_BRANCH": "feature/x", "CIRCLE_PULL_REQUEST": "https://github.com/titenkov/mkver/pull/42", "CIRCLE_BUILD_NUM": "55"},
+			BuildInfo{Provider: "circleci", Branch: "feature/x", PrNumber: "42", BuildNumber: "55"}, true},
+		{"circleci: tag", map[string]string{"CIRCLECI": "true", "CIRCLE_TAG": "v1.0.0", "CIRCLE_BUILD_NUM": "55"},
+			BuildInfo{Provider: "circleci", Tag: "v1.0.0", BuildNumber: "55"}, true},
+
+		// Bitbucket Pipelines
+		{"bitbucket: pull request", map[string]string{"BITBUCKET_BUILD_NUMBER": "8", "BITBUCKET_BRANCH": "feature/x", "BITBUCKET_PR_ID": "42", "BITBUCKET_PR_DESTINATION_BRANCH": "main", "BITBUCKET_COMMIT": "1a2b3c4d5e"},
+			BuildInfo{Provider: "bitbucket", Branch: "feature/x", PrNumber: "42", PrTargetBranch: "main", BuildNumber: "8", Sha: "1a2b3c4d5e"}, true},
+		{"bitbucket: tag", map[string]string{"BITBUCKET_BUILD_NUMBER": "8", "BITBUCKET_TAG": "v1.0.0"},
+			BuildInfo{Provider: "bitbucket", Tag: "v1.0.0", BuildNumber: "8"}, true},
+
+		// TeamCity sets BUILD_NUMBER just like Jenkins
+		{"teamcity: pull request", map[string]string{"TEAMCITY_VERSION": "2019.1", "BUILD_NUMBER": "99", "BUILD_VCS_NUMBER": "1a2b3c4d5e", "TEAMCITY_BUILD_PROPERTIES_FILE": teamCityBuild},
+			BuildInfo{Provider: "teamcity", Branch: "feature/x", PrNumber: "42", PrTargetBranch: "main", BuildNumber: "99", Sha: "1a2b3c4d5e"}, true},
+		{"teamcity: missing properties", map[string]string{"TEAMCITY_VERSION": "2019.1", "BUILD_NUMBER": "99", "TEAMCITY_BUILD_PROPERTIES_FILE": filepath.Join(dir, "missing.properties")},
+			BuildInfo{Provider: "teamcity", BuildNumber: "99"}, true},
+
+		// Buildkite
+		{"buildkite: branch", map[string]string{"BUILDKITE": "true", "BUILDKITE_BRANCH": "feature/x", "BUILDKITE_PULL_REQUEST": "false", "BUILDKITE_PULL_REQUEST_BASE_BRANCH": "", "BUILDKITE_BUILD_NUMBER": "3"},
+			BuildInfo{Provider: "buildkite", Branch: "feature/x", BuildNumber: "3"}, true},
+		{"buildkite: pull request", map[string]string{"BUILDKITE": "true", "BUILDKITE_BRANCH": "feature/x", "BUILDKITE_PULL_REQUEST": "42", "BUILDKITE_PULL_REQUEST_BASE_BRANCH": "main", "BUILDKITE_BUILD_NUMBER": "3", "BUILDKITE_COMMIT": "1a2b3c4d5e"},
+			BuildInfo{Provider: "buildkite", Branch: "feature/x", PrNumber: "42", PrTargetBranch: "main", BuildNumber: "3", Sha: "1a2b3c4d5e"}, true},
+		{"buildkite: tag", map[string]string{"BUILDKITE": "true", "BUILDKITE_BRANCH": "v1.0.0", "BUILDKITE_TAG": "v1.0.0", "BUILDKITE_PULL_REQUEST": "false", "BUILDKITE_BUILD_NUMBER": "3"},
+			BuildInfo{Provider: "buildkite", Tag: "v1.0.0", BuildNumber: "3"}, true},
+
+		// Travis CI
+		{"travis: branch", map[string]string{"TRAVIS": "true", "TRAVIS_BRANCH": "feature/x", "TRAVIS_PULL_REQUEST": "false", "TRAVIS_BUILD_NUMBER": "4", "TRAVIS_COMMIT": "1a2b3c4d5e"},
+			BuildInfo{Provider: "travis", Branch: "feature/x", BuildNumber: "4", Sha: "1a2b3c4d5e"}, true},
+		{"travis: pull request", map[string]string{"TRAVIS": "true", "TRAVIS_BRANCH": "main", "TRAVIS_PULL_REQUEST": "42", "TRAVIS_PULL_REQUEST_BRANCH": "feature/x", "TRAVIS_PULL_REQUEST_SHA": "5e4d3c2b1a", "TRAVIS_BUILD_NUMBER": "4", "TRAVIS_COMMIT": "1a2b3c4d5e"},
+			BuildInfo{Provider: "travis", Branch: "feature/x", PrNumber: "42", PrTargetBranch: "main", BuildNumber: "4", Sha: "5e4d3c2b1a"}, true},
+		{"travis: tag", map[string]string{"TRAVIS": "true", "TRAVIS_BRANCH": "v1.0.0", "TRAVIS_TAG": "v1.0.0", "TRAVIS_PULL_REQUEST": "false", "TRAVIS_BUILD_NUMBER": "4"},
+			BuildInfo{Provider: "travis", Tag: "v1.0.0", BuildNumber: "4"}, true},
+
+		// Drone
+		{"drone: branch", map[string]string{"DRONE": "true", "DRONE_BRANCH": "feature/x", "DRONE_BUILD_NUMBER": "6", "DRONE_COMMIT_SHA": "1a2b3c4d5e"},
+			BuildInfo{Provider: "drone", Branch: "feature/x", BuildNumber: "6", Sha: "1a2b3c4d5e"}, true},
+		{"drone: pull request", map[string]string{"DRONE": "true", "DRONE_BRANCH": "main", "DRONE_SOURCE_BRANCH": "feature/x", "DRONE_TARGET_BRANCH": "main", "DRONE_PULL_REQUEST": "42", "DRONE_BUILD_NUMBER": "6"},
+			BuildInfo{Provider: "drone", Branch: "feature/x", PrNumber: "42", PrTargetBranch: "main", BuildNumber: "6"}, true},
+		{"drone: tag", map[string]string{"DRONE": "true", "DRONE_TAG": "v1.0.0", "DRONE_BUILD_NUMBER": "6"},
+			BuildInfo{Provider: "drone", Tag: "v1.0.0", BuildNumber: "6"}, true},
+	}
+
+	for _, test := range tests {
+		restore := setCIEnv(test.env)
+		got, found := resolveBuildInfo(&Config{})
+		restore()
+
+		assert.Equal(t, test.found, found, "failed while testing "+test.name)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
+	}
+}
+
+func TestForcedCIProvider(t *testing.T) {
+	defer setCIEnv(map[string]string{"BUILD_NUMBER": "13", "BRANCH_NAME": "develop", "CI_PIPELINE_IID": "21", "CI_COMMIT_REF_NAME": "feature/x"})()
+
+	// Detected as jenkins, as GITLAB_CI is not set
+	info, found := resolveBuildInfo(&Config{})
+	assert.Assert(t, found)
+	assert.Equal(t, "jenkins", info.Provider)
+
+	info, found = resolveBuildInfo(&Config{ci: "gitlab"})
+	assert.Assert(t, found)
+	assert.Equal(t, BuildInfo{Provider: "gitlab", Branch: "feature/x", BuildNumber: "21"}, info)
+	assert.Equal(t, "21", resolveBuildNumber(&Config{ci: "gitlab"}))
+
+	assert.NilError(t, validateCI("gitlab"))
+	assert.Error(t, validateCI("hudson"), "Unknown CI provider \"hudson\", available providers: azure, bitbucket, buildkite, circleci, drone, github, gitlab, jenkins, teamcity, travis")
+}
+
+func TestResolveGitBranchOnCI(t *testing.T) {
+	defer setCIEnv(map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/tags/v1.0.0", "GITHUB_RUN_NUMBER": "7"})()
+
+	branch, err := resolveGitBranch(&Config{})
+	assert.NilError(t, err)
+	assert.Equal(t, "refs/tags/v1.0.0", branch)
+	assert.Equal(t, "7", resolveBuildNumber(&Config{}))
+	// Jenkins sets the branch to the tag name on tag builds
+	defer setCIEnv(map[string]string{"BUILD_NUMBER": "13", "BRANCH_NAME": "v1.0.0", "TAG_NAME": "v1.0.0"})()
+
+	branch, err = resolveGitBranch(&Config{})
+	assert.NilError(t, err)
+	assert.Equal(t, "refs/tags/v1.0.0", branch)
+}
+
+func TestGitLab(t *testing.T) {
+	defer setCIEnv(map[string]string{"GITLAB_CI": "true", "CI_COMMIT_REF_NAME": "feature/x", "CI_PIPELINE_IID": "21", "CI_COMMIT_SHORT_SHA": "1a2b3c4d"})()
+
+	got, err := Calculate(Config{gitRef: true, gitSha: true, gitBuildNum: "b"}, "1.0.0", "feature/x")
+	assert.NilError(t, err)
+	assert.Equal(t, "1.0.0-feature-x-b21-1a2b3c", got)
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileNames are looked up in the current directory and its parents, in this order
+var ConfigFileNames = []string{".mkver.yml", ".mkver.yaml", ".mkver.toml"}
+
+// Settings is a partial set of arguments, which can be declared in the config file.
+// Keys are the same as the flag names, unset values are nil.
+type Settings struct {
+	For               string   `yaml:"for" toml:"for"`
+	Source            *string  `yaml:"source" toml:"source"`
+	Sources           []string `yaml:"sources" toml:"sources"`
+	Env               *string  `yaml:"env" toml:"env"`
+	Gradle            *string  `yaml:"gradle" toml:"gradle"`
+	Maven             *string  `yaml:"maven" toml:"maven"`
+	GitTag            *bool    `yaml:"git-tag" toml:"git-tag"`
+	GitTagPrefix      *string  `yaml:"git-tag-prefix" toml:"git-tag-prefix"`
+	GitTagMode        *string  `yaml:"git-tag-mode" toml:"git-tag-mode"`
+	Npm               *string  `yaml:"npm" toml:"npm"`
+	NpmWorkspace      *string  `yaml:"npm-workspace" toml:"npm-workspace"`
+	Format            *string  `yaml:"format" toml:"format"`
+	Output            *string  `yaml:"output" toml:"output"`
+	Exports           []string `yaml:"export" toml:"export"`
+	ExportFile        *string  `yaml:"export-file" toml:"export-file"`
+	ExportPrefix      *string  `yaml:"export-prefix" toml:"export-prefix"`
+	WriteTo           []string `yaml:"write-to" toml:"write-to"`
+	Chart             *string  `yaml:"chart" toml:"chart"`
+	VersionFile       *string  `yaml:"version-file" toml:"version-file"`
+	DryRun            *bool    `yaml:"dry-run" toml:"dry-run"`
+	DockerPlus        *string  `yaml:"docker-plus" toml:"docker-plus"`
+	DockerFloating    *bool    `yaml:"docker-floating-tags" toml:"docker-floating-tags"`
+	DockerRelease     []string `yaml:"docker-release-branch" toml:"docker-release-branch"`
+	GitSha            *bool    `yaml:"git-sha" toml:"git-sha"`
+	GitRef            *bool    `yaml:"git-ref" toml:"git-ref"`
+	GitRefIgnore      []string `yaml:"git-ref-ignore" toml:"git-ref-ignore"`
+	GitBuildNum       *string  `yaml:"git-build-num" toml:"git-build-num"`
+	GitBuildNumBranch []string `yaml:"git-build-num-branch" toml:"git-build-num-branch"`
+
+	Snapshot          []string `yaml:"snapshot" toml:"snapshot"`
+	SnapshotQualifier *string  `yaml:"snapshot-qualifier" toml:"snapshot-qualifier"`
+
+	Timestamp       *bool   `yaml:"timestamp" toml:"timestamp"`
+	TimestampLayout *string `yaml:"timestamp-layout" toml:"timestamp-layout"`
+	Clock           *string `yaml:"clock" toml:"clock"`
+
+	GitDirty          *bool   `yaml:"dirty" toml:"dirty"`
+	GitDirtyMarker    *string `yaml:"dirty-marker" toml:"dirty-marker"`
+	GitDirtyTimestamp *bool   `yaml:"dirty-timestamp" toml:"dirty-timestamp"`
+	VerifyNonDirty    *bool   `yaml:"verify-non-dirty" toml:"verify-non-dirty"`
+
+	Release       *bool `yaml:"release" toml:"release"`
+	VerifyRelease *bool `yaml:"verify-release" toml:"verify-release"`
+
+	CI             *string `yaml:"ci" toml:"ci"`
+	PullRequest    *bool   `yaml:"pull-request" toml:"pull-request"`
+	DetachedBranch *string `yaml:"detached-branch" toml:"detached-branch"`
+
+	Workflow *string      `yaml:"workflow" toml:"workflow"`
+	Rules    []BranchRule `yaml:"rules" toml:"rules"`
+
+	Profiles map[string]Profile `yaml:"profiles" toml:"profiles"`
+}
+
+// Trace records the value of a single setting and where it came from
+type Trace struct {
+	Value  string
+	Origin string
+}
+
+// Applies the settings on top of the config, recording the origin of every value
+func (c *Config) apply(s Settings, origin string) {
+	if s.Source != nil {
+		c.source = *s.Source
+		c.trace("source", c.source, origin)
+	}
+	if s.Sources != nil {
+		c.sources = s.Sources
+		c.trace("sources", c.sources, origin)
+	}
+	if s.Env != nil {
+		c.env = *s.Env
+		c.trace("env", c.env, origin)
+	}
+	if s.Gradle != nil {
+		c.gradle = *s.Gradle
+		c.trace("gradle", c.gradle, origin)
+	}
+	if s.Maven != nil {
+		c.maven = *s.Maven
+		c.trace("maven", c.maven, origin)
+	}
+	if s.GitTag != nil {
+		c.gitTag = *s.GitTag
+		c.trace("git-tag", c.gitTag, origin)
+	}
+	if s.GitTagPrefix != nil {
+		c.gitTagPrefix = *s.GitTagPrefix
+		c.trace("git-tag-prefix", c.gitTagPrefix, origin)
+	}
+	if s.GitTagMode != nil {
+		c.gitTagMode = *s.GitTagMode
+		c.trace("git-tag-mode", c.gitTagMode, origin)
+	}
+	if s.Npm != nil {
+		c.npm = *s.Npm
+		c.trace("npm", c.npm, origin)
+	}
+	if s.NpmWorkspace != nil {
+		c.npmWorkspace = *s.NpmWorkspace
+		c.trace("npm-workspace", c.npmWorkspace, origin)
+	}
+	if s.Format != nil {
+		c.format = *s.Format
+		c.trace("format", c.format, origin)
+	}
+	if s.Output != nil {
+		c.output = *s.Output
+		c.trace("output", c.output, origin)
+	}
+	if s.Exports != nil {
+		c.exports = s.Exports
+		c.trace("export", c.exports, origin)
+	}
+	if s.ExportFile != nil {
+		c.exportFile = *s.ExportFile
+		c.trace("export-file", c.exportFile, origin)
+	}
+	if s.ExportPrefix != nil {
+		c.exportPrefix = *s.ExportPrefix
+		c.trace("export-prefix", c.exportPrefix, origin)
+	}
+	if s.WriteTo != nil {
+		c.writeTo = s.WriteTo
+		c.trace("write-to", c.writeTo, origin)
+	}
+	if s.Chart != nil {
+		c.chart = *s.Chart
+		c.trace("chart", c.chart, origin)
+	}
+	if s.VersionFile != nil {
+		c.versionFile = *s.VersionFile
+		c.trace("version-file", c.versionFile, origin)
+	}
+	if s.DryRun != nil {
+		c.dryRun = *s.DryRun
+		c.trace("dry-run", c.dryRun, origin)
+	}
+	if s.DockerPlus != nil {
+		c.dockerPlus = *s.DockerPlus
+		c.trace("docker-plus", c.dockerPlus, origin)
+	}
+	if s.DockerFloating != nil {
+		c.dockerFloating = *s.DockerFloating
+		c.trace("docker-floating-tags", c.dockerFloating, origin)
+	}
+	if s.DockerRelease != nil {
+		c.dockerRelease = s.DockerRelease
+		c.trace("docker-release-branch", c.dockerRelease, origin)
+	}
+	if s.GitSha != nil {
+		c.gitSha = *s.GitSha
+		c.trace("git-sha", c.gitSha, origin)
+	}
+	if s.GitRef != nil {
+		c.gitRef = *s.GitRef
+		c.trace("git-ref", c.gitRef, origin)
+	}
+	if s.GitRefIgnore != nil {
+		c.gitRefIgnore = s.GitRefIgnore
+		c.trace("git-ref-ignore", c.gitRefIgnore, origin)
+	}
+	if s.GitBuildNum != nil {
+		c.gitBuildNum = *s.GitBuildNum
+		c.trace("git-build-num", c.gitBuildNum, origin)
+	}
+	if s.GitBuildNumBranch != nil {
+		c.gitBuildNumBranch = s.GitBuildNumBranch
+		c.trace("git-build-num-branch", c.gitBuildNumBranch, origin)
+	}
+	if s.Snapshot != nil {
+		c.snapshot = s.Snapshot
+		c.trace("snapshot", c.snapshot, origin)
+	}
+	if s.SnapshotQualifier != nil {
+		c.snapshotQualifier = *s.SnapshotQualifier
+		c.trace("snapshot-qualifier", c.snapshotQualifier, origin)
+	}
+	if s.Timestamp != nil {
+		c.timestamp = *s.Timestamp
+		c.trace("timestamp", c.timestamp, origin)
+	}
+	if s.TimestampLayout != nil {
+		c.timestampLayout = *s.TimestampLayout
+		c.trace("timestamp-layout", c.timestampLayout, origin)
+	}
+	if s.Clock != nil {
+		c.clock = *s.Clock
+		c.trace("clock", c.clock, origin)
+	}
+	if s.GitDirty != nil {
+		c.gitDirty = *s.GitDirty
+		c.trace("dirty", c.gitDirty, origin)
+	}
+	if s.GitDirtyMarker != nil {
+		c.gitDirtyMarker = *s.GitDirtyMarker
+		c.trace("dirty-marker", c.gitDirtyMarker, origin)
+	}
+	if s.GitDirtyTimestamp != nil {
+		c.gitDirtyTimestamp = *s.GitDirtyTimestamp
+		c.trace("dirty-timestamp", c.gitDirtyTimestamp, origin)
+	}
+	if s.VerifyNonDirty != nil {
+		c.verifyNonDirty = *s.VerifyNonDirty
+		c.trace("verify-non-dirty", c.verifyNonDirty, origin)
+	}
+	if s.Release != nil {
+		c.release = *s.Release
+		c.trace("release", c.release, origin)
+	}
+	if s.VerifyRelease != nil {
+		c.verifyRelease = *s.VerifyRelease
+		c.trace("verify-release", c.verifyRelease, origin)
+	}
+	if s.CI != nil {
+		c.ci = *s.CI
+		c.trace("ci", c.ci, origin)
+	}
+	if s.PullRequest != nil {
+		c.pullRequest = *s.PullRequest
+		c.trace("pull-request", c.pullRequest, origin)
+	}
+	if s.DetachedBranch != nil {
+		c.detachedBranch = *s.DetachedBranch
+		c.trace("detached-branch", c.detachedBranch, origin)
+	}
+	if s.Workflow != nil {
+		c.workflow = *s.Workflow
+		c.trace("workflow", c.workflow, origin)
+	}
+	if s.Rules != nil {
+		c.rules = s.Rules
+		var patterns []string
+		for _, r := range c.rules {
+			patterns = append(patterns, r.Branch)
+		}
+		c.trace("rules", patterns, origin)
+	}
+}
+
+func (c *Config) trace(key string, value interface{}, origin string) {
+	if c.traces == nil {
+		c.traces = map[string]Trace{}
+	}
+	c.traces[key] = Trace{Value: fmt.Sprint(value), Origin: origin}
+}
+
+// Explain describes every setting of the merged config and where it came from
+func (c *Config) Explain() string {
+	keys := make([]string, 0, len(c.traces))
+	for key := range c.traces {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s = %s (%s)\n", key, c.traces[key].Value, c.traces[key].Origin)
+	}
+	return b.String()
+}
+
+// Converts the config into settings with every non-zero value set
+func settingsOf(c Config) Settings {
+	var s Settings
+	if len(c.source) > 0 {
+		s.Source = &c.source
+	}
+	s.Sources = c.sources
+	if len(c.env) > 0 {
+		s.Env = &c.env
+	}
+	if len(c.gradle) > 0 {
+		s.Gradle = &c.gradle
+	}
+	if len(c.maven) > 0 {
+		s.Maven = &c.maven
+	}
+	if c.gitTag {
+		s.GitTag = &c.gitTag
+	}
+	if len(c.gitTagPrefix) > 0 {
+		s.GitTagPrefix = &c.gitTagPrefix
+	}
+	if len(c.gitTagMode) > 0 {
+		s.GitTagMode = &c.gitTagMode
+	}
+	if len(c.npm) > 0 {
+		s.Npm = &c.npm
+	}
+	if len(c.npmWorkspace) > 0 {
+		s.NpmWorkspace = &c.npmWorkspace
+	}
+	if len(c.format) > 0 {
+		s.Format = &c.format
+	}
+	if len(c.output) > 0 {
+		s.Output = &c.output
+	}
+	s.Exports = c.exports
+	if len(c.exportFile) > 0 {
+		s.ExportFile = &c.exportFile
+	}
+	if len(c.exportPrefix) > 0 {
+		s.ExportPrefix = &c.exportPrefix
+	}
+	s.WriteTo = c.writeTo
+	if len(c.chart) > 0 {
+		s.Chart = &c.chart
+	}
+	if len(c.versionFile) > 0 {
+		s.VersionFile = &c.versionFile
+	}
+	if c.dryRun {
+		s.DryRun = &c.dryRun
+	}
+	if len(c.dockerPlus) > 0 {
+		s.DockerPlus = &c.dockerPlus
+	}
+	if c.dockerFloating {
+		s.DockerFloating = &c.dockerFloating
+	}
+	if c.gitSha {
+		s.GitSha = &c.gitSha
+	}
+	if c.gitRef {
+		s.GitRef = &c.gitRef
+	}
+	if len(c.gitBuildNum) > 0 {
+		s.GitBuildNum = &c.gitBuildNum
+	}
+	if c.timestamp {
+		s.Timestamp = &c.timestamp
+	}
+	if len(c.timestampLayout) > 0 {
+		s.TimestampLayout = &c.timestampLayout
+	}
+	if len(c.clock) > 0 {
+		s.Clock = &c.clock
+	}
+	if c.gitDirty {
+		s.GitDirty = &c.gitDirty
+	}
+	if len(c.gitDirtyMarker) > 0 {
+		s.GitDirtyMarker = &c.gitDirtyMarker
+	}
+	if c.gitDirtyTimestamp {
+		s.GitDirtyTimestamp = &c.gitDirtyTimestamp
+	}
+	if c.verifyNonDirty {
+		s.VerifyNonDirty = &c.verifyNonDirty
+	}
+	if c.release {
+		s.Release = &c.release
+	}
+	if c.verifyRelease {
+		s.VerifyRelease = &c.verifyRelease
+	}
+	if len(c.ci) > 0 {
+		s.CI = &c.ci
+	}
+	if c.pullRequest {
+		s.PullRequest = &c.pullRequest
+	}
+	if len(c.detachedBranch) > 0 {
+		s.DetachedBranch = &c.detachedBranch
+	}
+	if len(c.workflow) > 0 {
+		s.Workflow = &c.workflow
+	}
+	s.GitRefIgnore = c.gitRefIgnore
+	if len(c.snapshotQualifier) > 0 {
+		s.SnapshotQualifier = &c.snapshotQualifier
+	}
+	s.GitBuildNumBranch = c.gitBuildNumBranch
+	s.DockerRelease = c.dockerRelease
+	s.Snapshot = c.snapshot
+	s.Rules = c.rules
+	return s
+}
+
+// Looks for the config file in the directory and its parents
+func findConfigFile(dir string) (string, bool) {
+	for {
+		for _, name := range ConfigFileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, true
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Resolves the relative paths of the files against the directory of the config file,
+// so that the config file found in a parent directory reads and writes the same files
+func (s *Settings) resolvePaths(dir string) {
+	for _, path := range []*string{s.Gradle, s.Maven, s.Npm, s.ExportFile, s.Chart, s.VersionFile} {
+		if path != nil && len(*path) > 0 && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	for _, profile := range s.Profiles {
+		profile.Settings.resolvePaths(dir)
+	}
+}
+
+// Reads settings from the yaml or toml file, depending on its extension
+func readSettingsFile(path string) (Settings, error) {
+	var s Settings
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("Failed to read config file %s: %v", path, err)
+	}
+
+	if filepath.Ext(path) == ".toml" {
+		md, err := toml.NewDecoder(bytes.NewReader(content)).Decode(&s)
+		if err != nil {
+			return s, fmt.Errorf("Failed to parse config file %s: %v", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return s, fmt.Errorf("Failed to parse config file %s: unknown key %q", path, undecoded[0].String())
+		}
+		return s, nil
+	}
+
+	if err := yaml.UnmarshalStrict(content, &s); err != nil {
+		return s, fmt.Errorf("Failed to parse config file %s: %v", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/assert"
+)
+
+var cmpConfig = cmp.AllowUnexported(Config{})
+
+func writeFile(t *testing.T, path string, content string) {
+	assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NilError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "mkver")
+	assert.NilError(t, err)
+	dir, _ = filepath.EvalSymlinks(dir)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+var SettingsFileTests = []struct {
+	name     string
+	file     string
+	content  string
+	expected Config
+	err      string
+}{
+	{"yaml", ".mkver.yml", "git-ref: true\ngit-ref-ignore: [\"^develop$\"]\ngit-build-num: rc.\nformat: \"{{.Version}}\"\n",
+		Config{gitRef: true, gitRefIgnore: []string{"^develop$"}, gitBuildNum: "rc.", format: "{{.Version}}"}, ""},
+	{"toml", ".mkver.toml", "git-sha = true\ngradle = \"app/gradle.properties\"\ngit-build-num-branch = [\"^release\"]\n",
+		Config{gitSha: true, gradle: "app/gradle.properties", gitBuildNumBranch: []string{"^release"}}, ""},
+	{"yaml: rules", ".mkver.yml", "workflow: gitflow\nrules:\n  - branch: ^release/\n    git-build-num: rc.\n    git-sha: false\n",
+		Config{workflow: "gitflow", rules: []BranchRule{{Branch: "^release/", GitBuildNum: stringOf("rc."), GitSha: boolOf(false)}}}, ""},
+	{"toml: rules", ".mkver.toml", "[[rules]]\nbranch = \"^release/\"\ngit-ref = false\n",
+		Config{rules: []BranchRule{{Branch: "^release/", GitRef: boolOf(false)}}}, ""},
+	{"yaml: unknown key", ".mkver.yml", "git-reff: true\n", Config{}, "field git-reff not found"},
+	{"toml: unknown key", ".mkver.toml", "git-reff = true\n", Config{}, "unknown key \"git-reff\""},
+}
+
+func TestReadSettingsFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	for _, test := range SettingsFileTests {
+		path := filepath.Join(dir, test.file)
+		writeFile(t, path, test.content)
+
+		settings, err := readSettingsFile(path)
+		if len(test.err) > 0 {
+			assert.ErrorContains(t, err, test.err, "failed while testing "+test.name)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+test.name)
+
+		var config Config
+		config.apply(settings, path)
+		config.traces = nil
+		assert.DeepEqual(t, test.expected, config, cmpConfig)
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(dir, ".mkver.toml"), "")
+	writeFile(t, filepath.Join(dir, "sub", ".mkver.yml"), "")
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "sub", "nested", "deep"), 0755))
+
+	path, found := findConfigFile(filepath.Join(dir, "sub", "nested", "deep"))
+	assert.Assert(t, found)
+	assert.Equal(t, filepath.Join(dir, "sub", ".mkver.yml"), path)
+
+	path, found = findConfigFile(dir)
+	assert.Assert(t, found)
+	assert.Equal(t, filepath.Join(dir, ".mkver.toml"), path)
+}
+
+func TestExplain(t *testing.T) {
+	var config Config
+	config.apply(settingsOf(DefaultConfigs["npm"]), "profile npm")
+	config.apply(Settings{GitRefIgnore: []string{"^main$"}}, ".mkver.yml")
+	config.apply(Settings{GitSha: boolOf(true)}, "flags")
+
+	assert.Equal(t, "git-ref = true (profile npm)\ngit-ref-ignore = [^main$] (.mkver.yml)\ngit-sha = true (flags)\n", config.Explain())
+}
+
+func TestConfigFilePaths(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(dir, ".mkver.yml"), "source: gradle\ngradle: app/gradle.properties\nversion-file: VERSION\n"+
+		"profiles:\n  web:\n    npm: web/package.json\n")
+	writeFile(t, filepath.Join(dir, "app", "gradle.properties"), "version=1.2.3\n")
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	assert.NilError(t, os.Chdir(filepath.Join(dir, "sub")))
+
+	// Paths of the config file found in the parent directory are relative to it
+	config, err := configureArgs(t)
+	assert.NilError(t, err)
+	version, _, err := resolveVersion(&config)
+	assert.NilError(t, err)
+	assert.Equal(t, "1.2.3", version)
+	assert.Equal(t, filepath.Join(dir, "VERSION"), config.versionFile)
+
+	config, err = configureArgs(t, "--for", "web")
+	assert.NilError(t, err)
+	assert.Equal(t, filepath.Join(dir, "web", "package.json"), config.npm)
+
+	// Paths of the flags are relative to the current directory
+	config, err = configureArgs(t, "--version-file", "VERSION")
+	assert.NilError(t, err)
+	assert.Equal(t, "VERSION", config.versionFile)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DockerTagMaxLength is the limit of the image tag length imposed by the registries
+const DockerTagMaxLength = 128
+
+// DockerReleaseBranches are the branches, which releases move 1, 1.2, 1.2.3 and latest image tags on
+var DockerReleaseBranches = []string{"^main$", "^master$"}
+
+// Image tag grammar of the distribution spec: [A-Za-z0-9_][A-Za-z0-9_.-]{0,127}
+var dockerTagGrammar = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+var dockerTagInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// Sanitizes the version to be a valid image tag: '+' of the build metadata is replaced with the replacement,
+// the rest of the invalid characters with '-'. Tags longer than 128 characters get the ref (sanitized branch) truncated,
+// keeping the hash of the whole ref as a suffix, so that different long branches never share the tag.
+// The core version, the build number and the sha stay intact. If the tag doesn't contain the ref (f.e. custom template),
+// the whole tag is truncated keeping its hash as a suffix instead.
+// F.e. 1.0.0-b13+git.1a2b3c => 1.0.0-b13_git.1a2b3c
+func dockerTag(version string, ref string, replacement string) (string, error) {
+	tag := strings.Replace(version, "+", replacement, -1)
+	tag = dockerTagInvalidChars.ReplaceAllString(tag, "-")
+	tag = strings.TrimLeft(tag, ".-")
+
+	if excess := len(tag) - DockerTagMaxLength; excess > 0 {
+		if i := strings.Index(tag, ref); len(ref) > 0 && i >= 0 && len(ref)-excess-9 > 0 {
+			short := strings.TrimRight(ref[:len(ref)-excess-9], ".-") + "-" + shortHash(ref)
+			tag = tag[:i] + short + tag[i+len(ref):]
+		} else {
+			// The ref is not a part of the tag (f.e. custom --format) or is too short to make room
+			tag = strings.TrimRight(tag[:DockerTagMaxLength-9], ".-") + "-" + shortHash(tag)
+		}
+	}
+
+	if !dockerTagGrammar.MatchString(tag) {
+		return "", fmt.Errorf("Failed to produce docker tag of version %q", version)
+	}
+	return tag, nil
+}
+
+// Returns the first 8 hex digits of sha256 of the value
+func shortHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// Produces the image tags of the version. With floating tags, releases built from tags or release branches
+// (--docker-release-branch, ^main$ and ^master$ by default) get 1, 1.0, 1.0.0 and latest as well,
+// and builds of the branch get <branch>-latest. Prereleases never move the release tags.
+// F.e. 1.2.3 (master) => 1.2.3, 1, 1.2, latest, master-latest; 1.2.3-feature-x-b13 (feature/x) => 1.2.3-feature-x-b13, feature-x-latest
+func dockerTags(cfg *Config, version string, branch string) ([]string, error) {
+	replacement := valueOr(cfg.dockerPlus, DockerPlusFlag.Value)
+	ref := sanitizeRef(branch)
+	tag, err := dockerTag(version, ref, replacement)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{tag}
+	if !cfg.dockerFloating {
+		return tags, nil
+	}
+
+	var floating []string
+	releaseBranches := cfg.dockerRelease
+	if len(releaseBranches) == 0 {
+		releaseBranches = DockerReleaseBranches
+	}
+	released := strings.HasPrefix(branch, TagRefPrefix) || matchesAny(releaseBranches, branch)
+	if semver, err := ParseSemVerLenient(version); err == nil && !semver.IsPrerelease() && released {
+		floating = append(floating,
+			fmt.Sprintf("%d", semver.Major),
+			fmt.Sprintf("%d.%d", semver.Major, semver.Minor),
+			semver.Core(),
+			"latest")
+	}
+	if !strings.HasPrefix(branch, TagRefPrefix) && branch != "unknown" {
+		floating = append(floating, ref+"-latest")
+	}
+
+	for _, f := range floating {
+		if f, err = dockerTag(f, ref, replacement); err != nil {
+			return nil, err
+		}
+		if !contains(tags, f) {
+			tags = append(tags, f)
+		}
+	}
+	return tags, nil
+}
+
+func validateDockerPlus(replacement string) error {
+	if len(replacement) > 0 && dockerTagInvalidChars.MatchString(replacement) {
+		return fmt.Errorf("Invalid docker '+' replacement %q: use letters, digits, '_', '.' or '-'", replacement)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestDockerTag(t *testing.T) {
+	ref := "feature-" + strings.Repeat("x", 150)
+	long := "1.0.0-" + ref + "-b13+git.1a2b3c"
+
+	var tests = []struct {
+		version     string
+		ref         string
+		replacement string
+		expected    string
+		err         string
+	}{
+		{"1.0.0", "master", "_", "1.0.0", ""},
+		{"1.0.0-b13+git.1a2b3c", "master", "_", "1.0.0-b13_git.1a2b3c", ""},
+		{"1.0.0-b13+git.1a2b3c", "master", "-", "1.0.0-b13-git.1a2b3c", ""},
+		{"1.0.0-b13+git.1a2b3c", "master", "", "1.0.0-b13git.1a2b3c", ""},
+		{"1.0.0-feature/x@1", "feature-x", "_", "1.0.0-feature-x-1", ""},
+		{".1.0.0", "master", "_", "1.0.0", ""},
+		{long, ref, "_", "1.0.0-feature-" + strings.Repeat("x", 90) + "-d0195c8a-b13_git.1a2b3c", ""},
+		{long, "develop", "_", "1.0.0-feature-" + strings.Repeat("x", 105) + "-14dfcb95", ""},
+		{"+", "", "", "", "Failed to produce docker tag of version \"+\""},
+	}
+
+	for _, test := range tests {
+		got, err := dockerTag(test.version, test.ref, test.replacement)
+		if len(test.err) > 0 {
+			assert.Error(t, err, test.err, "failed while testing "+test.version)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+test.version)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.version)
+		assert.Assert(t, len(got) <= DockerTagMaxLength)
+	}
+
+	// The hash is stable and differs for different refs sharing the truncated part
+	a, _ := dockerTag(long, ref, "_")
+	b, _ := dockerTag("1.0.0-"+ref+"x-b13+git.1a2b3c", ref+"x", "_")
+	assert.Equal(t, a[:len(a)-24], b[:len(b)-24])
+	assert.Equal(t, a[len(a)-15:], b[len(b)-15:])
+	assert.Assert(t, a != b)
+}
+
+func TestDockerTags(t *testing.T) {
+	var tests = []struct {
+		name     string
+		config   Config
+		version  string
+		branch   string
+		expected []string
+	}{
+		{"no floating tags", Config{}, "1.2.3+git.1a2b3c", "master", []string{"1.2.3_git.1a2b3c"}},
+		{"release", Config{dockerFloating: true}, "1.2.3", "master", []string{"1.2.3", "1", "1.2", "latest", "master-latest"}},
+		{"release: build metadata", Config{dockerFloating: true, dockerPlus: "."}, "1.2.3+b13", "main", []string{"1.2.3.b13", "1", "1.2", "1.2.3", "latest", "main-latest"}},
+		{"release: other branch", Config{dockerFloating: true}, "1.2.3", "release/1.2.3", []string{"1.2.3", "release-1.2.3-latest"}},
+		{"release: develop without qualifier", Config{dockerFloating: true}, "1.2.3", "develop", []string{"1.2.3", "develop-latest"}},
+		{"release: configured branch", Config{dockerFloating: true, dockerRelease: []string{"^release/"}}, "1.2.3", "release/1.2.3", []string{"1.2.3", "1", "1.2", "latest", "release-1.2.3-latest"}},
+		{"prerelease", Config{dockerFloating: true}, "1.2.3-feature-x-b13", "feature/X", []string{"1.2.3-feature-x-b13", "feature-x-latest"}},
+		{"tag", Config{dockerFloating: true}, "1.2.3", "refs/tags/v1.2.3", []string{"1.2.3", "1", "1.2", "latest"}},
+		{"template", Config{dockerFloating: true}, "app-1.2", "develop", []string{"app-1.2", "develop-latest"}},
+		{"long branch", Config{dockerFloating: true}, "1.2.3-" + strings.Repeat("x", 130) + "-b13", strings.Repeat("x", 130),
+			[]string{"1.2.3-" + strings.Repeat("x", 109) + "-3afbb132-b13", strings.Repeat("x", 112) + "-3afbb132-latest"}},
+	}
+
+	for _, test := range tests {
+		got, err := dockerTags(&test.config, test.version, test.branch)
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.DeepEqual(t, test.expected, got)
+	}
+
+	assert.NilError(t, validateDockerPlus("-"))
+	assert.Error(t, validateDockerPlus("+"), "Invalid docker '+' replacement \"+\": use letters, digits, '_', '.' or '-'")
+}
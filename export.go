@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// ExportFormats are the formats the components of the version can be exported in:
+// "dotenv" and "gitlab" write the file (GitLab dotenv artifact), "github-output" and "github-env" append to
+// $GITHUB_OUTPUT and $GITHUB_ENV, "azure" and "shell" print logging commands and export statements to stdout.
+var ExportFormats = []string{"dotenv", "gitlab", "github-output", "github-env", "azure", "shell"}
+
+// ExportVariable is a single KEY=VALUE pair of the export
+type ExportVariable struct {
+	Name  string
+	Value string
+}
+
+// Lists the components of the report as variables, named after the fields with the prefix.
+// F.e. MKVER_VERSION=1.0.0-feature-x-SNAPSHOT, MKVER_BUILD_NUMBER=13
+func exportVariables(report Report, prefix string) []ExportVariable {
+	var variables []ExportVariable
+	value := reflect.ValueOf(report)
+	for i := 0; i < value.NumField(); i++ {
+		name := strings.Split(value.Type().Field(i).Tag.Get("json"), ",")[0]
+		variables = append(variables, ExportVariable{Name: prefix + screamingSnake(name), Value: fmt.Sprint(value.Field(i).Interface())})
+	}
+	return variables
+}
+
+// Converts camelCase to SCREAMING_SNAKE_CASE, f.e. buildNumber => BUILD_NUMBER
+func screamingSnake(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// Renders the variables in the format
+func renderExport(format string, variables []ExportVariable) string {
+	var b strings.Builder
+	for _, v := range variables {
+		switch format {
+		case "dotenv":
+			fmt.Fprintf(&b, "%s=%s\n", v.Name, dotenvQuote(v.Value))
+		case "gitlab":
+			// GitLab takes the values as is and doesn't support multiline ones
+			fmt.Fprintf(&b, "%s=%s\n", v.Name, strings.Replace(v.Value, "\n", " ", -1))
+		case "github-output", "github-env":
+			if strings.Contains(v.Value, "\n") {
+				fmt.Fprintf(&b, "%s<<MKVER_EOF\n%s\nMKVER_EOF\n", v.Name, v.Value)
+			} else {
+				fmt.Fprintf(&b, "%s=%s\n", v.Name, v.Value)
+			}
+		case "azure":
+			fmt.Fprintf(&b, "##vso[task.setvariable variable=%s]%s\n", v.Name, azureEscape(v.Value))
+		case "shell":
+			fmt.Fprintf(&b, "export %s='%s'\n", v.Name, strings.Replace(v.Value, "'", `'\''`, -1))
+		}
+	}
+	return b.String()
+}
+
+// Quotes the value, if it has characters dotenv parsers treat specially
+func dotenvQuote(value string) string {
+	if !strings.ContainsAny(value, " \t\n\"'#$\\=") {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// Escapes the value of Azure Pipelines logging command
+func azureEscape(value string) string {
+	return strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+// Exports the report in the format: writes the file, appends to the file of GitHub Actions or prints to stdout.
+// Returns whether the export went to stdout.
+func exportReport(stdout io.Writer, report Report, format string, file string, prefix string) (bool, error) {
+	content := renderExport(format, exportVariables(report, prefix))
+
+	switch format {
+	case "dotenv", "gitlab":
+		path := valueOr(file, ExportFileFlag.Value)
+		if err := writeFileKeepingMode(path, []byte(content)); err != nil {
+			return false, fmt.Errorf("Failed to export %s: %v", format, err)
+		}
+		return false, nil
+	case "github-output", "github-env":
+		name := "GITHUB_OUTPUT"
+		if format == "github-env" {
+			name = "GITHUB_ENV"
+		}
+		path := os.Getenv(name)
+		if len(path) == 0 {
+			return false, fmt.Errorf("Failed to export %s: env variable $%s is not set, it's available on GitHub Actions only", format, name)
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return false, fmt.Errorf("Failed to export %s: %v", format, err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(content); err != nil {
+			return false, fmt.Errorf("Failed to export %s: %v", format, err)
+		}
+		return false, nil
+	}
+
+	_, err := io.WriteString(stdout, content)
+	return true, err
+}
+
+func validateExports(formats []string) error {
+	for _, format := range formats {
+		if !contains(ExportFormats, format) {
+			return fmt.Errorf("Unknown export format %q, available formats: %s", format, strings.Join(ExportFormats, ", "))
+		}
+	}
+	// Both of them write --export-file, the latter would overwrite the former
+	if contains(formats, "dotenv") && contains(formats, "gitlab") {
+		return fmt.Errorf("Export formats dotenv and gitlab both write to --%s, use one of them", ExportFileFlag.Name)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestExportVariables(t *testing.T) {
+	variables := exportVariables(Report{Version: "1.0.0-b13", Major: 1, TagDistance: 3, BuildNumber: "13", PrSourceBranch: "feature/x", Dirty: true}, "APP_")
+
+	values := map[string]string{}
+	var names []string
+	for _, v := range variables {
+		values[v.Name] = v.Value
+		names = append(names, v.Name)
+	}
+	assert.DeepEqual(t, []string{
+		"APP_VERSION", "APP_ORIGIN", "APP_MAJOR", "APP_MINOR", "APP_PATCH", "APP_PRERELEASE", "APP_BUILD",
+		"APP_SOURCE", "APP_PROFILE", "APP_RULE", "APP_BRANCH", "APP_REF", "APP_SHA", "APP_TAG", "APP_TAG_DISTANCE",
+		"APP_BUILD_NUMBER", "APP_CI", "APP_PR_NUMBER", "APP_PR_SOURCE_BRANCH", "APP_PR_TARGET_BRANCH", "APP_TIMESTAMP", "APP_DIRTY",
+	}, names)
+	assert.Equal(t, "1.0.0-b13", values["APP_VERSION"])
+	assert.Equal(t, "1", values["APP_MAJOR"])
+	assert.Equal(t, "3", values["APP_TAG_DISTANCE"])
+	assert.Equal(t, "feature/x", values["APP_PR_SOURCE_BRANCH"])
+	assert.Equal(t, "true", values["APP_DIRTY"])
+	assert.Equal(t, "", values["APP_CI"])
+}
+
+func TestRenderExport(t *testing.T) {
+	variables := []ExportVariable{
+		{"MKVER_VERSION", "1.0.0-b13+git.1a2b3c"},
+		{"MKVER_BRANCH", "feature/it's $HOME"},
+		{"MKVER_RULE", "100%\nmatch"},
+	}
+
+	var tests = []struct {
+		format   string
+		expected string
+	}{
+		{"dotenv", "MKVER_VERSION=1.0.0-b13+git.1a2b3c\nMKVER_BRANCH=\"feature/it's \\$HOME\"\nMKVER_RULE=\"100%\\nmatch\"\n"},
+		{"gitlab", "MKVER_VERSION=1.0.0-b13+git.1a2b3c\nMKVER_BRANCH=feature/it's $HOME\nMKVER_RULE=100% match\n"},
+		{"github-output", "MKVER_VERSION=1.0.0-b13+git.1a2b3c\nMKVER_BRANCH=feature/it's $HOME\nMKVER_RULE<<MKVER_EOF\n100%\nmatch\nMKVER_EOF\n"},
+		{"github-env", "MKVER_VERSION=1.0.0-b13+git.1a2b3c\nMKVER_BRANCH=feature/it's $HOME\nMKVER_RULE<<MKVER_EOF\n100%\nmatch\nMKVER_EOF\n"},
+		{"azure", "##vso[task.setvariable variable=MKVER_VERSION]1.0.0-b13+git.1a2b3c\n##vso[task.setvariable variable=MKVER_BRANCH]feature/it's $HOME\n##vso[task.setvariable variable=MKVER_RULE]100%AZP25%0Amatch\n"},
+		{"shell", "export MKVER_VERSION='1.0.0-b13+git.1a2b3c'\nexport MKVER_BRANCH='feature/it'\\''s $HOME'\nexport MKVER_RULE='100%\nmatch'\n"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, renderExport(test.format, variables), "failed while testing "+test.format)
+	}
+}
+
+func TestExportReport(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	report := Report{Version: "1.0.0", Major: 1}
+	file := filepath.Join(dir, "build.env")
+	githubOutput := filepath.Join(dir, "github_output")
+	writeFile(t, githubOutput, "previous=step\n")
+	os.Setenv("GITHUB_OUTPUT", githubOutput)
+	defer os.Unsetenv("GITHUB_OUTPUT")
+	os.Unsetenv("GITHUB_ENV")
+
+	var stdout bytes.Buffer
+	toStdout, err := exportReport(&stdout, report, "gitlab", file, "")
+	assert.NilError(t, err)
+	assert.Assert(t, !toStdout)
+	content, _ := ioutil.ReadFile(file)
+	assert.Assert(t, bytes.HasPrefix(content, []byte("VERSION=1.0.0\nORIGIN=\nMAJOR=1\n")), string(content))
+
+	toStdout, err = exportReport(&stdout, report, "github-output", "", "MKVER_")
+	assert.NilError(t, err)
+	assert.Assert(t, !toStdout)
+	content, _ = ioutil.ReadFile(githubOutput)
+	assert.Assert(t, bytes.HasPrefix(content, []byte("previous=step\nMKVER_VERSION=1.0.0\n")), string(content))
+
+	_, err = exportReport(&stdout, report, "github-env", "", "MKVER_")
+	assert.Error(t, err, "Failed to export github-env: env variable $GITHUB_ENV is not set, it's available on GitHub Actions only")
+
+	assert.Equal(t, 0, stdout.Len())
+	toStdout, err = exportReport(&stdout, report, "shell", "", "MKVER_")
+	assert.NilError(t, err)
+	assert.Assert(t, toStdout)
+	assert.Assert(t, bytes.HasPrefix(stdout.Bytes(), []byte("export MKVER_VERSION='1.0.0'\n")), stdout.String())
+
+	assert.NilError(t, validateExports([]string{"dotenv", "azure"}))
+	assert.Error(t, validateExports([]string{"dotenv", "jenkins"}), "Unknown export format \"jenkins\", available formats: dotenv, gitlab, github-output, github-env, azure, shell")
+	assert.Error(t, validateExports([]string{"gitlab", "shell", "dotenv"}), "Export formats dotenv and gitlab both write to --export-file, use one of them")
+}
@@ -4,6 +4,13 @@ import (
 	"github.com/urfave/cli"
 )
 
+// SourceFlag allows to force one of the version sources instead of trying them in order
+// F.e. --source=git-tag
+var SourceFlag = cli.StringFlag{
+	Name:  "source",
+	Usage: "Resolve version from the source: env, gradle, maven, npm or git-tag",
+}
+
 // EnvFlag allows resolving version from the env variable
 var EnvFlag = cli.StringFlag{
 	Name:  "env",
@@ -18,43 +25,79 @@ var GradleFlag = cli.StringFlag{
 	Usage: "Resolve version from gradle",
 }
 
+// MavenFlag allows resolving version from the maven pom.xml file
+var MavenFlag = cli.StringFlag{
+	Name:  "maven",
+	Value: "pom.xml",
+	Usage: "Resolve version from maven",
+}
+
+// NpmFlag allows resolving version from the package.json file
+var NpmFlag = cli.StringFlag{
+	Name:  "npm",
+	Value: "package.json",
+	Usage: "Resolve version from npm",
+}
+
+// NpmWorkspaceFlag allows resolving version from the workspace member, when the root package.json has no version
+// Workspace is specified either by the package name or by its directory
+var NpmWorkspaceFlag = cli.StringFlag{
+	Name:  "npm-workspace",
+	Usage: "Resolve version from the npm workspace",
+}
+
+// GitTagFlag allows resolving version from the nearest git tag reachable from HEAD
+// F.e. 1.4.2 (on tag v1.4.2), 1.4.2-3-gabc123 (3 commits after tag v1.4.2)
+var GitTagFlag = cli.BoolFlag{
+	Name:  "git-tag",
+	Usage: "Resolve version from git tags",
+}
+
+// GitTagPrefixFlag allows to specify the prefix the version tags start with
+// F.e. "v" for v1.4.2 or "service-a/" for service-a/1.4.2 in monorepo
+var GitTagPrefixFlag = cli.StringFlag{
+	Name:  "git-tag-prefix",
+	Value: "v",
+	Usage: "Prefix of the version tags",
+}
+
+// GitTagModeFlag allows to specify how the version is derived from the tag, when HEAD is not exactly on it
+// F.e. 3 commits after tag v1.4.2: 1.4.2-3-gabc123 (describe), 1.4.3-dev.3 (next-patch), 1.4.2 (tag)
+var GitTagModeFlag = cli.StringFlag{
+	Name:  "git-tag-mode",
+	Value: "describe",
+	Usage: "Derive version from git tag: describe, next-patch or tag",
+}
+
 // ReleaseFlag allows creating release version
-// F.e. 1.0.0-SNAPSHOT -> 1.0.0
-// var ReleaseFlag = cli.BoolFlag{
-// 	Name:  "release",
-// 	Usage: "Produce release version",
-// }
+// F.e. 1.0.0-SNAPSHOT -> 1.0.0, 1.0.0-rc.3+git.abc -> 1.0.0
+var ReleaseFlag = cli.BoolFlag{
+	Name:  "release",
+	Usage: "Produce release version",
+}
 
 // VerifyReleaseFlag allows verify the version to be a release one
-// F.e. 1.0.0 -> True, 1.0.0-SNAPSHOT -> False
-// var VerifyReleaseFlag = cli.BoolFlag{
-// 	Name:  "verify-release",
-// 	Usage: "Verify to be a release version",
-// }
-
-// BumpFlag allows to increase the patch version
-// F.e. 1.0.0 -> 1.0.1
-// var BumpFlag = cli.BoolFlag{
-// 	Name:  "bump",
-// 	Usage: "Increase version",
-// }
-
-// BumpMinorFlag allows to increase the minor version
-// F.e. 1.0.0 -> 1.1.0
-// var BumpMinorFlag = cli.BoolFlag{
-// 	Name:  "bump-minor",
-// 	Usage: "Increase minor version",
-// }
-
-// BumpMajorFlag allows to increase the patch version
-// F.e. 1.0.0 -> 2.0.0
-// var BumpMajorFlag = cli.BoolFlag{
-// 	Name:  "bump-major",
-// 	Usage: "Increase major version",
-// }
+// F.e. 1.0.0 -> True, 1.0.0-SNAPSHOT -> False (exits with the reason)
+var VerifyReleaseFlag = cli.BoolFlag{
+	Name:  "verify-release",
+	Usage: "Verify to be a release version",
+}
+
+// PreidFlag allows to specify the prerelease identifier of the bumped version
+// F.e. mkver bump prerelease --preid rc: 1.2.3 -> 1.2.4-rc.0, mkver bump major --preid rc: 1.2.3 -> 2.0.0-rc.0
+var PreidFlag = cli.StringFlag{
+	Name:  "preid",
+	Usage: "Prerelease identifier of the bumped version, f.e. rc",
+}
+
+// WriteFlag allows to write the bumped version back to the source it was resolved from: gradle, maven or npm
+var WriteFlag = cli.BoolFlag{
+	Name:  "write",
+	Usage: "Write the bumped version back to the source",
+}
 
 // GitBuildNumFlag allows to include build number into the version while being on the release/hotfix branch
-// Build number is resolved from the $BUILD_NUMBER env variable
+// Build number is reported by CI, f.e. $BUILD_NUMBER on Jenkins or $GITHUB_RUN_NUMBER on GitHub Actions
 // 1.0.0 -> 1.0.0-rc.1 (release/1.0.0 branch)
 // 1.0.0 -> 1.0.0 (defect/x branch)
 var GitBuildNumFlag = cli.StringFlag{
@@ -91,44 +134,260 @@ var GitRefIgnoreFlag = cli.StringSliceFlag{
 }
 
 // SnapshotFlag allows marking some branch versions with snapshot suffix
+// Snapshot suffix is stripped on the rest of the branches
+// F.e. 1.0.0 -> 1.0.0-SNAPSHOT (develop branch), 1.0.0-SNAPSHOT -> 1.0.0 (release/1.0.0 branch)
 var SnapshotFlag = cli.StringSliceFlag{
 	Name:  "snapshot",
 	Usage: "Specify branches which require snapshot in the version",
 }
 
-// GitVerifyNonDirtyFlag allows to verify git not to be dirty (throws error)
-// var GitVerifyNonDirtyFlag = cli.BoolFlag{
-// 	Name:  "verify-non-dirty",
-// 	Usage: "Verify non dirty git directory",
-//}
+// SnapshotQualifierFlag allows to change the snapshot suffix, f.e. to "dev" for npm packages
+var SnapshotQualifierFlag = cli.StringFlag{
+	Name:  "snapshot-qualifier",
+	Value: "SNAPSHOT",
+	Usage: "Snapshot suffix to add to the version",
+}
+
+// CIFlag allows to force the CI provider instead of detecting it from the environment
+// F.e. --ci=gitlab
+var CIFlag = cli.StringFlag{
+	Name:  "ci",
+	Usage: "Read build info from the CI provider: azure, bitbucket, buildkite, circleci, drone, github, gitlab, jenkins, teamcity or travis",
+}
+
+// PullRequestFlag allows to version pull request builds as pr.<number>.<build number>, instead of the source branch
+// F.e. 1.4.0-SNAPSHOT => 1.4.0-pr.123.7
+var PullRequestFlag = cli.BoolFlag{
+	Name:  "pull-request",
+	Usage: "Version pull requests as pr.<number>.<build number>",
+}
+
+// DetachedBranchFlag allows to set the branch, when HEAD is detached and neither a tag nor a branch points to it
+// F.e. --detached-branch=develop
+var DetachedBranchFlag = cli.StringFlag{
+	Name:  "detached-branch",
+	Usage: "Branch to use when HEAD is detached and no tag or branch contains it",
+}
+
+// WorkflowFlag allows to use pre-defined branch rules of the branching model
+// F.e. --workflow=gitflow: master -> 1.0.0, release/1.0.0 -> 1.0.0-rc.13, feature/x -> 1.0.0-feature-x-1a2b3c
+var WorkflowFlag = cli.StringFlag{
+	Name:  "workflow",
+	Usage: "Use branch rules of the workflow: gitflow, trunk or release-branch",
+}
+
+// GitVerifyNonDirtyFlag allows to verify git not to be dirty
+// Fails with the list of changed paths, if there are uncommitted or untracked changes
+var GitVerifyNonDirtyFlag = cli.BoolFlag{
+	Name:  "verify-non-dirty",
+	Usage: "Verify non dirty git directory",
+}
 
 // GitDirtyFlag allows to mark version in case of dirty git
 // If git is dirty, version will be changed accordingly
 // F.e. 1.0.0 -> 1.0.0-dirty
-// var GitDirtyFlag = cli.StringFlag{
-// 	Name:  "dirty",
-// 	Value: "dirty",
-// 	Usage: "Include 'dirty' into the version",
-// }
-
-// GitDirtyTimestampFlag allows to append timestamp if git is dirty
-// F.e. 1.0.0 -> 1.0.0-dirty-122310123
-// var GitDirtyTimestampFlag = cli.BoolFlag{
-// 	Name:  "dirty-timestamp",
-// 	Usage: "Include timestamp into the version, when git is dirty",
-// }
+var GitDirtyFlag = cli.BoolFlag{
+	Name:  "dirty",
+	Usage: "Include the marker into the version, when git is dirty",
+}
+
+// GitDirtyMarkerFlag allows to change the marker of dirty git, it has to be a valid prerelease identifier
+// F.e. --dirty --dirty-marker=local -> 1.0.0-local
+var GitDirtyMarkerFlag = cli.StringFlag{
+	Name:  "dirty-marker",
+	Value: "dirty",
+	Usage: "Marker included into the version, when git is dirty",
+}
+
+// GitDirtyTimestampFlag allows to append timestamp to the dirty marker, it implies --dirty
+// F.e. 1.0.0 -> 1.0.0-dirty.20191017101500
+var GitDirtyTimestampFlag = cli.BoolFlag{
+	Name:  "dirty-timestamp",
+	Usage: "Include the marker with timestamp into the version, when git is dirty (implies --dirty)",
+}
 
 // TimestampFlag allows to append timestamp to the version
-// F.e. 1.0.0 -> 1.0.0-122310123
-// var TimestampFlag = cli.BoolFlag{
-// 	Name:  "timestamp",
-// 	Usage: "Include timestamp into the version",
-// }
+// F.e. 1.0.0 -> 1.0.0-20191017101500
+var TimestampFlag = cli.BoolFlag{
+	Name:  "timestamp",
+	Usage: "Include timestamp into the version",
+}
 
-// ForFlag allows to use one of the predefined configs
+// TimestampLayoutFlag allows to change the layout of the timestamp: yyyyMMddHHmmss, iso-basic, unix or Go layout
+// F.e. --timestamp-layout=iso-basic -> 20191017T101500Z, --timestamp-layout=unix -> 1571307300
+var TimestampLayoutFlag = cli.StringFlag{
+	Name:  "timestamp-layout",
+	Value: "yyyyMMddHHmmss",
+	Usage: "Layout of the timestamp: yyyyMMddHHmmss, iso-basic, unix or Go layout",
+}
+
+// ClockFlag allows to take the timestamp from the commit, the current time or $SOURCE_DATE_EPOCH
+// F.e. --clock=commit makes re-running the same commit yield the same version
+var ClockFlag = cli.StringFlag{
+	Name:  "clock",
+	Usage: "Take the timestamp from: commit, now or source-date-epoch ($SOURCE_DATE_EPOCH if set, now otherwise)",
+}
+
+// FormatFlag allows rendering the version from the template
+// F.e. --format='{{.Major}}.{{.Minor}}-{{.GitRef}}.{{.BuildNumber}}' -> 1.0-feature-x.13
+var FormatFlag = cli.StringFlag{
+	Name:  "format",
+	Usage: "Render the version using the template",
+}
+
+// OutputFlag allows to print all components of the version or the image tags instead of the version alone: text, json, yaml or docker
+// F.e. --output=json -> {"version": "1.0.0-feature-x-SNAPSHOT", "origin": "1.0.0-SNAPSHOT", "major": 1, ...}
+// or --output=docker -> 1.0.0-b13_git.1a2b3c
+var OutputFlag = cli.StringFlag{
+	Name:  "output",
+	Usage: "Print the version (text), all of its components (json, yaml) or the image tags (docker)",
+}
+
+// DockerPlusFlag allows to change the character replacing '+' of the build metadata in the image tag
+// F.e. --docker-plus=- -> 1.0.0-b13-git.1a2b3c
+var DockerPlusFlag = cli.StringFlag{
+	Name:  "docker-plus",
+	Value: "_",
+	Usage: "Replacement of '+' in the image tag",
+}
+
+// DockerFloatingTagsFlag allows to print the floating image tags besides the version one
+// F.e. 1.2.3 (master) -> 1.2.3, 1, 1.2, latest, master-latest
+var DockerFloatingTagsFlag = cli.BoolFlag{
+	Name:  "docker-floating-tags",
+	Usage: "Print floating image tags: 1, 1.2, 1.2.3, latest and <branch>-latest",
+}
+
+// DockerReleaseBranchFlag allows to specify branch pattern, which releases get 1, 1.2, 1.2.3 and latest image tags on.
+// Tag builds always get them. F.e. --docker-release-branch=^release/ -> 1.2.3 (release/1.2) => 1.2.3, 1, 1.2, latest
+var DockerReleaseBranchFlag = cli.StringSliceFlag{
+	Name:  "docker-release-branch",
+	Usage: "Specify branch patterns using regexp, which move the release image tags (^main$ and ^master$ by default)",
+}
+
+// ExportFlag allows to export all components of the version as variables: dotenv, gitlab, github-output, github-env, azure or shell
+// F.e. --export=github-output appends MKVER_VERSION=1.0.0, MKVER_MAJOR=1, ... to $GITHUB_OUTPUT
+var ExportFlag = cli.StringSliceFlag{
+	Name:  "export",
+	Usage: "Export components of the version: dotenv, gitlab, github-output, github-env, azure or shell",
+}
+
+// ExportFileFlag allows to specify the file the dotenv and gitlab exports are written to
+var ExportFileFlag = cli.StringFlag{
+	Name:  "export-file",
+	Value: "mkver.env",
+	Usage: "File to write dotenv and gitlab exports to",
+}
+
+// ExportPrefixFlag allows to change the prefix of the exported variables
+// F.e. --export-prefix=APP_ -> APP_VERSION, APP_MAJOR, ...
+var ExportPrefixFlag = cli.StringFlag{
+	Name:  "export-prefix",
+	Value: "MKVER_",
+	Usage: "Prefix of the exported variables",
+}
+
+// WriteToFlag allows to write the version to the manifests: gradle, maven, npm, chart or version-file
+// F.e. --write-to=gradle --write-to=chart updates the version in gradle.properties and Chart.yaml
+var WriteToFlag = cli.StringSliceFlag{
+	Name:  "write-to",
+	Usage: "Write the version to the manifest: gradle, maven, npm, chart or version-file",
+}
+
+// ChartFlag allows to specify the Helm chart the version is written to
+var ChartFlag = cli.StringFlag{
+	Name:  "chart",
+	Value: "Chart.yaml",
+	Usage: "Helm chart to write the version to",
+}
+
+// VersionFileFlag allows to specify the plain text file the version is written to
+var VersionFileFlag = cli.StringFlag{
+	Name:  "version-file",
+	Value: "VERSION",
+	Usage: "File to write the version to",
+}
+
+// DryRunFlag allows to preview the changes of the manifests as the diff printed to stderr, instead of writing them
+var DryRunFlag = cli.BoolFlag{
+	Name:  "dry-run",
+	Usage: "Print the diff of the manifests to stderr instead of writing them",
+}
+
+// ConfigFlag allows to specify the config file
+// By default .mkver.yml, .mkver.yaml or .mkver.toml is looked up in the current directory and its parents
+var ConfigFlag = cli.StringFlag{
+	Name:  "config",
+	Usage: "Read settings from the config file",
+}
+
+// ProfilesFlag allows to share profiles across projects
+// Profiles are read from ~/.config/mkver and then from the listed files or directories
+var ProfilesFlag = cli.StringFlag{
+	Name:   "profiles",
+	EnvVar: "MKVER_PROFILES",
+	Usage:  "Read shared profiles from the files or directories (separated by the OS path list separator)",
+}
+
+// ExplainFlag allows to print the merged settings and where each of them comes from
+var ExplainFlag = cli.BoolFlag{
+	Name:  "explain",
+	Usage: "Print settings with their origin to stderr",
+}
+
+// ForFlag allows to use one of the predefined or user-defined configs
 // F.e. --for=app === --git-ref --git-build-num --dirty --dirty-timestamp
 var ForFlag = cli.StringFlag{
 	Name:  "for",
 	Value: "app",
 	Usage: "Use pre-defined configuration",
 }
+
+// Flags are the flags of the version calculation in the order of the help
+var Flags = []cli.Flag{
+	SourceFlag,
+	EnvFlag,
+	GradleFlag,
+	MavenFlag,
+	NpmFlag,
+	NpmWorkspaceFlag,
+	GitTagFlag,
+	GitTagPrefixFlag,
+	GitTagModeFlag,
+	GitShaFlag,
+	GitBuildNumFlag,
+	GitBuildNumBranchFlag,
+	GitRefFlag,
+	GitRefIgnoreFlag,
+	SnapshotFlag,
+	SnapshotQualifierFlag,
+	WorkflowFlag,
+	TimestampFlag,
+	TimestampLayoutFlag,
+	ClockFlag,
+	GitDirtyFlag,
+	GitDirtyMarkerFlag,
+	GitDirtyTimestampFlag,
+	GitVerifyNonDirtyFlag,
+	ReleaseFlag,
+	VerifyReleaseFlag,
+	CIFlag,
+	PullRequestFlag,
+	DetachedBranchFlag,
+	ForFlag,
+	FormatFlag,
+	OutputFlag,
+	ExportFlag,
+	ExportFileFlag,
+	ExportPrefixFlag,
+	WriteToFlag,
+	ChartFlag,
+	VersionFileFlag,
+	DryRunFlag,
+	DockerPlusFlag,
+	DockerFloatingTagsFlag,
+	DockerReleaseBranchFlag,
+	ConfigFlag,
+	ProfilesFlag,
+	ExplainFlag,
+}
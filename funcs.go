@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// FuncMap contains the functions available in the version templates.
+// Functions take the piped value as the last argument, f.e. {{.GitBranch | slug | trunc 20}}
+var FuncMap = template.FuncMap{
+	"lower":        strings.ToLower,
+	"upper":        strings.ToUpper,
+	"slug":         slug,
+	"trunc":        trunc,
+	"pad":          pad,
+	"replace":      replace,
+	"regexReplace": regexReplace,
+	"trimPrefix":   trimPrefix,
+	"trimSuffix":   trimSuffix,
+	"default":      defaultValue,
+	"env":          os.Getenv,
+	"now":          now,
+	"date":         date,
+	"short":        short,
+	"incMajor":     incMajor,
+	"incMinor":     incMinor,
+	"incPatch":     incPatch,
+}
+
+var nonSlugChars = regexp.MustCompile("[^a-z0-9]+")
+
+// Lowercases the string and replaces every run of non alphanumeric characters with "-"
+// F.e. feature/TEST_123 => feature-test-123
+func slug(s string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// Cuts the string to at most n characters, multi-byte characters are never split
+func trunc(n int, s string) string {
+	if runes := []rune(s); n >= 0 && len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// Left pads the string up to the width (in characters) with the given padding, the padding is cut to fit exactly
+// F.e. {{.BuildNumber | pad 4 "0"}} => 0013, {{"7" | pad 4 "ab"}} => aba7
+func pad(width int, padding string, s string) string {
+	missing := width - len([]rune(s))
+	if len(padding) == 0 || missing <= 0 {
+		return s
+	}
+	prefix := []rune(strings.Repeat(padding, missing))
+	return string(prefix[:missing]) + s
+}
+
+func replace(old, new, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+func regexReplace(pattern, repl, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+func trimPrefix(prefix, s string) string {
+	return strings.TrimPrefix(s, prefix)
+}
+
+func trimSuffix(suffix, s string) string {
+	return strings.TrimSuffix(s, suffix)
+}
+
+// Returns the default, if the value is empty
+// F.e. {{.GitBranch | default "unknown"}}
+func defaultValue(def string, value string) string {
+	if len(value) == 0 {
+		return def
+	}
+	return value
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// Formats the time using Go layout. The time is either a time.Time or a string:
+// .Timestamp in any of the named layouts, RFC 3339 or seconds since epoch.
+// F.e. {{now | date "20060102"}} => 20191017, {{.Timestamp | date "2006-01-02"}} => 2019-10-17
+func date(layout string, value interface{}) (string, error) {
+	switch t := value.(type) {
+	case time.Time:
+		return t.Format(layout), nil
+	case string:
+		parsed, err := parseTimestamp(t)
+		if err != nil {
+			return "", err
+		}
+		return parsed.Format(layout), nil
+	}
+	return "", fmt.Errorf("date: unsupported value %v of type %T", value, value)
+}
+
+// Shortens the git sha to n characters
+func short(n int, sha string) string {
+	return trunc(n, sha)
+}
+
+func incMajor(version string) (string, error) {
+	semver, err := ParseSemVerLenient(version)
+	return semver.IncMajor().String(), err
+}
+
+func incMinor(version string) (string, error) {
+	semver, err := ParseSemVerLenient(version)
+	return semver.IncMinor().String(), err
+}
+
+func incPatch(version string) (string, error) {
+	semver, err := ParseSemVerLenient(version)
+	return semver.IncPatch().String(), err
+}
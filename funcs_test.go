@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+var FuncTests = []struct {
+	name     string
+	metadata Metadata
+	template string
+	expected string
+}{
+	{"lower", Metadata{GitBranch: "feature/X"}, "{{.GitBranch | lower}}", "feature/x"},
+	{"upper", Metadata{GitBranch: "feature/x"}, "{{.GitBranch | upper}}", "FEATURE/X"},
+	{"slug", Metadata{GitBranch: "feature/TEST_123--x/"}, "{{.GitBranch | slug}}", "feature-test-123-x"},
+	{"trunc", Metadata{GitBranch: "feature/very-long-name"}, "{{.GitBranch | slug | trunc 12}}", "feature-very"},
+	{"trunc: short", Metadata{GitBranch: "develop"}, "{{.GitBranch | trunc 12}}", "develop"},
+	{"trunc: non-ascii", Metadata{GitBranch: "feature/größe"}, "{{.GitBranch | trunc 11}}", "feature/grö"},
+	{"pad", Metadata{BuildNumber: "13"}, "{{.BuildNumber | pad 4 \"0\"}}", "0013"},
+	{"pad: cut padding", Metadata{BuildNumber: "7"}, "{{.BuildNumber | pad 4 \"ab\"}}", "aba7"},
+	{"pad: non-ascii", Metadata{GitRef: "größe"}, "{{.GitRef | pad 7 \"·\"}}", "··größe"},
+	{"pad: wider", Metadata{BuildNumber: "12345"}, "{{.BuildNumber | pad 4 \"0\"}}", "12345"},
+	{"date: timestamp", Metadata{Timestamp: "20191017101500"}, "{{.Timestamp | date \"2006-01-02\"}}", "2019-10-17"},
+	{"date: iso-basic", Metadata{Timestamp: "20191017T101500Z"}, "{{.Timestamp | date \"15:04\"}}", "10:15"},
+	{"date: unix", Metadata{Timestamp: "1571307300"}, "{{.Timestamp | date \"20060102T1504\"}}", "20191017T1015"},
+	{"replace", Metadata{GitBranch: "feature/x"}, "{{.GitBranch | replace \"/\" \"_\"}}", "feature_x"},
+	{"regexReplace", Metadata{GitBranch: "feature/JIRA-123-some-text"}, "{{.GitBranch | regexReplace \"^feature/([A-Z]+-[0-9]+).*$\" \"$1\"}}", "JIRA-123"},
+	{"trimPrefix", Metadata{GitBranch: "feature/x"}, "{{.GitBranch | trimPrefix \"feature/\"}}", "x"},
+	{"trimSuffix", Metadata{Origin: "1.0.0-SNAPSHOT"}, "{{.Origin | trimSuffix \"-SNAPSHOT\"}}", "1.0.0"},
+	{"default", Metadata{}, "{{.GitBranch | default \"unknown\"}}", "unknown"},
+	{"default: present", Metadata{GitBranch: "develop"}, "{{.GitBranch | default \"unknown\"}}", "develop"},
+	{"env", Metadata{}, "{{env \"MKVER_TEST_ENV\"}}", "value"},
+	{"short", Metadata{GitSha: "1a2b3c4d5e6f"}, "{{.GitSha | short 7}}", "1a2b3c4"},
+	{"incMajor", Metadata{Origin: "1.2.3"}, "{{.Origin | incMajor}}", "2.0.0"},
+	{"incMinor", Metadata{Origin: "1.2.3-SNAPSHOT"}, "{{.Origin | incMinor}}", "1.3.0"},
+	{"incPatch", Metadata{Origin: "1.2.3"}, "{{.Origin | incPatch}}", "1.2.4"},
+	{"incPatch: prerelease", Metadata{Origin: "1.2.3-rc.1"}, "{{.Origin | incPatch}}", "1.2.3"},
+}
+
+func TestFuncs(t *testing.T) {
+	os.Setenv("MKVER_TEST_ENV", "value")
+	defer os.Unsetenv("MKVER_TEST_ENV")
+
+	for _, test := range FuncTests {
+		got, err := New(test.metadata).Execute(test.template)
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
+	}
+}
+
+func TestFuncsDate(t *testing.T) {
+	got, err := New(Metadata{}).Execute("{{now | date \"2006\"}}")
+	assert.NilError(t, err)
+	assert.Equal(t, now().Format("2006"), got)
+}
+
+func TestFuncsDateOfInvalidTimestamp(t *testing.T) {
+	_, err := New(Metadata{Timestamp: "2019-10-17"}).Execute("{{.Timestamp | date \"2006\"}}")
+	assert.ErrorContains(t, err, "Failed to parse timestamp \"2019-10-17\"")
+}
@@ -0,0 +1,787 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitRepository reads git metadata directly from the .git directory, without git binary
+type GitRepository struct {
+	gitDir    string // Directory with HEAD and index of the working tree, f.e. .git or .git/worktrees/x
+	commonDir string // Directory with objects and refs shared across the working trees
+	workTree  string
+
+	objectDirs []string
+	packs      []*gitPack
+}
+
+// GitCommit contains the commit fields used for versioning
+type GitCommit struct {
+	Sha     string
+	Parents []string
+	Time    time.Time // Committer time
+}
+
+// ErrNotGitRepository is returned, when neither the directory nor its parents contain .git
+var ErrNotGitRepository = errors.New("not a git repository")
+
+// OpenGitRepository finds .git in the directory or its parents. Both .git directories and gitfiles are supported,
+// the latter are used by worktrees ("gitdir: /repo/.git/worktrees/x") and submodules ("gitdir: ../.git/modules/x").
+func OpenGitRepository(dir string) (*GitRepository, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			gitDir := dotGit
+			if !info.IsDir() {
+				if gitDir, err = readGitFile(dotGit); err != nil {
+					return nil, err
+				}
+			}
+			return newGitRepository(gitDir, dir)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotGitRepository
+		}
+		dir = parent
+	}
+}
+
+// Close closes the pack files opened by the reads, the repository stays usable and reopens them when needed
+func (r *GitRepository) Close() error {
+	var err error
+	for _, pack := range r.packs {
+		if pack.file == nil {
+			continue
+		}
+		if e := pack.file.Close(); e != nil && err == nil {
+			err = e
+		}
+		pack.file = nil
+	}
+	return err
+}
+
+// Reads the path from the gitfile, f.e. "gitdir: ../.git/modules/x"
+func readGitFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", fmt.Errorf("invalid gitfile %s", path)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	return filepath.Clean(gitDir), nil
+}
+
+func newGitRepository(gitDir string, workTree string) (*GitRepository, error) {
+	repo := &GitRepository{gitDir: gitDir, commonDir: gitDir, workTree: workTree}
+
+	// Linked worktrees share objects and refs with the main repository
+	if content, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir := strings.TrimSpace(string(content))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+		repo.commonDir = filepath.Clean(commonDir)
+	}
+
+	if _, err := os.Stat(filepath.Join(repo.commonDir, "objects")); err != nil {
+		return nil, fmt.Errorf("invalid git directory %s: %v", gitDir, err)
+	}
+
+	repo.objectDirs = []string{filepath.Join(repo.commonDir, "objects")}
+	if content, err := ioutil.ReadFile(filepath.Join(repo.commonDir, "objects", "info", "alternates")); err == nil {
+		for _, alternate := range strings.Split(string(content), "\n") {
+			if alternate = strings.TrimSpace(alternate); len(alternate) > 0 && !strings.HasPrefix(alternate, "#") {
+				if !filepath.IsAbs(alternate) {
+					alternate = filepath.Join(repo.commonDir, "objects", alternate)
+				}
+				repo.objectDirs = append(repo.objectDirs, filepath.Clean(alternate))
+			}
+		}
+	}
+
+	return repo, nil
+}
+
+// WorkTree returns the root directory of the working tree
+func (r *GitRepository) WorkTree() string {
+	return r.workTree
+}
+
+//
+// REFS
+//
+
+// Head returns the branch checked out and the sha of HEAD. Branch is empty, if HEAD is detached.
+// Sha is empty, if the branch has no commits yet (f.e. right after "git init").
+func (r *GitRepository) Head() (string, string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(r.gitDir, "HEAD"))
+	if err != nil {
+		return "", "", err
+	}
+
+	head := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(head, "ref:") {
+		return "", head, nil
+	}
+
+	ref := strings.TrimSpace(strings.TrimPrefix(head, "ref:"))
+	sha, err := r.ResolveRef(ref)
+	if _, unborn := err.(refNotFoundError); unborn {
+		return strings.TrimPrefix(ref, "refs/heads/"), "", nil
+	}
+	return strings.TrimPrefix(ref, "refs/heads/"), sha, err
+}
+
+// refNotFoundError is returned, when neither loose nor packed ref exists
+type refNotFoundError string
+
+func (e refNotFoundError) Error() string {
+	return fmt.Sprintf("ref %s not found", string(e))
+}
+
+// ResolveRef returns sha the ref points to, following symbolic refs
+func (r *GitRepository) ResolveRef(ref string) (string, error) {
+	for depth := 0; depth < 10; depth++ {
+		content, err := r.readLooseRef(ref)
+		if os.IsNotExist(err) {
+			refs, err := r.packedRefs()
+			if err != nil {
+				return "", err
+			}
+			if packed, found := refs[ref]; found {
+				return packed.sha, nil
+			}
+			return "", refNotFoundError(ref)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if !strings.HasPrefix(content, "ref:") {
+			return content, nil
+		}
+		ref = strings.TrimSpace(strings.TrimPrefix(content, "ref:"))
+	}
+	return "", fmt.Errorf("ref %s is too deeply nested", ref)
+}
+
+// Reads the loose ref, per-worktree refs take precedence over the shared ones
+func (r *GitRepository) readLooseRef(ref string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(r.gitDir, filepath.FromSlash(ref)))
+	if os.IsNotExist(err) && r.commonDir != r.gitDir {
+		content, err = ioutil.ReadFile(filepath.Join(r.commonDir, filepath.FromSlash(ref)))
+	}
+	return strings.TrimSpace(string(content)), err
+}
+
+type packedRef struct {
+	sha    string
+	peeled string // Commit annotated tag points to
+}
+
+// Reads packed-refs, f.e. "<sha> refs/tags/v1.0.0" optionally followed by "^<peeled sha>"
+func (r *GitRepository) packedRefs() (map[string]packedRef, error) {
+	refs := map[string]packedRef{}
+
+	file, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return refs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var last string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#") || len(line) == 0:
+		case strings.HasPrefix(line, "^"):
+			if ref, found := refs[last]; found {
+				ref.peeled = line[1:]
+				refs[last] = ref
+			}
+		default:
+			if fields := strings.Fields(line); len(fields) == 2 {
+				refs[fields[1]] = packedRef{sha: fields[0]}
+				last = fields[1]
+			}
+		}
+	}
+	return refs, scanner.Err()
+}
+
+// Refs returns refs with the prefix, f.e. "refs/tags/", mapped to the shas they point to.
+// Annotated tags are peeled to the commits.
+func (r *GitRepository) Refs(prefix string) (map[string]string, error) {
+	refs := map[string]string{}
+
+	packed, err := r.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for name, ref := range packed {
+		if strings.HasPrefix(name, prefix) {
+			refs[name] = ref.sha
+			if len(ref.peeled) > 0 {
+				refs[name] = ref.peeled
+			}
+		}
+	}
+
+	// Loose refs take precedence over the packed ones
+	root := filepath.Join(r.commonDir, filepath.FromSlash(prefix))
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(r.commonDir, path)
+		sha, err := r.ResolveRef(filepath.ToSlash(rel))
+		if err == nil {
+			refs[filepath.ToSlash(rel)] = sha
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for name, sha := range refs {
+		if refs[name], err = r.peel(sha); err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// Follows annotated tags down to the object they point to
+func (r *GitRepository) peel(sha string) (string, error) {
+	for depth := 0; depth < 10; depth++ {
+		kind, data, err := r.ReadObject(sha)
+		if err != nil {
+			return "", err
+		}
+		if kind != "tag" {
+			return sha, nil
+		}
+		object := headerField(data, "object")
+		if len(object) == 0 {
+			return "", fmt.Errorf("invalid tag object %s", sha)
+		}
+		sha = object
+	}
+	return "", fmt.Errorf("tag %s is too deeply nested", sha)
+}
+
+// Tags returns the names of tags by the commits they point to
+func (r *GitRepository) Tags() (map[string][]string, error) {
+	refs, err := r.Refs("refs/tags/")
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string][]string{}
+	for name, sha := range refs {
+		tags[sha] = append(tags[sha], strings.TrimPrefix(name, "refs/tags/"))
+	}
+	for _, names := range tags {
+		sort.Strings(names)
+	}
+	return tags, nil
+}
+
+// NearestBranch finds the branch containing the commit closest to its tip, preferring local branches over remote ones.
+// Remote branches are named without the remote, f.e. refs/remotes/origin/main => main.
+// Returns false, if no branch contains the commit.
+func (r *GitRepository) NearestBranch(sha string) (string, bool, error) {
+	type candidate struct {
+		name   string
+		remote bool
+	}
+	better := func(a, b candidate) bool {
+		return !a.remote && b.remote || a.remote == b.remote && a.name < b.name
+	}
+
+	// Walks once from all the tips in breadth-first order, each commit keeps the best branch among the closest ones
+	nearest := map[string]candidate{}
+	var level []string
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/"} {
+		refs, err := r.Refs(prefix)
+		if err != nil {
+			return "", false, err
+		}
+
+		for ref, tip := range refs {
+			c := candidate{name: strings.TrimPrefix(ref, prefix), remote: prefix == "refs/remotes/"}
+			if c.remote {
+				slash := strings.Index(c.name, "/")
+				if slash < 0 || c.name[slash+1:] == "HEAD" {
+					continue
+				}
+				c.name = c.name[slash+1:]
+			}
+
+			if current, found := nearest[tip]; !found {
+				nearest[tip] = c
+				level = append(level, tip)
+			} else if better(c, current) {
+				nearest[tip] = c
+			}
+		}
+	}
+
+	shallow := r.shallowCommits()
+	for len(level) > 0 {
+		if c, found := nearest[sha]; found {
+			return c.name, true, nil
+		}
+
+		var next []string
+		reached := map[string]bool{}
+		for _, current := range level {
+			if shallow[current] {
+				continue
+			}
+			commit, err := r.Commit(current)
+			if err != nil {
+				return "", false, err
+			}
+			for _, parent := range commit.Parents {
+				previous, found := nearest[parent]
+				switch {
+				case !found:
+					nearest[parent] = nearest[current]
+					reached[parent] = true
+					next = append(next, parent)
+				case reached[parent] && better(nearest[current], previous):
+					nearest[parent] = nearest[current]
+				}
+			}
+		}
+		level = next
+	}
+	return "", false, nil
+}
+
+//
+// COMMITS
+//
+
+// Commit reads the commit object
+func (r *GitRepository) Commit(sha string) (GitCommit, error) {
+	commit := GitCommit{Sha: sha}
+
+	kind, data, err := r.ReadObject(sha)
+	if err != nil {
+		return commit, err
+	}
+	if kind != "commit" {
+		return commit, fmt.Errorf("object %s is a %s, not a commit", sha, kind)
+	}
+
+	for _, line := range strings.Split(string(headerOf(data)), "\n") {
+		switch {
+		case strings.HasPrefix(line, "parent "):
+			commit.Parents = append(commit.Parents, strings.TrimPrefix(line, "parent "))
+		case strings.HasPrefix(line, "committer "):
+			// committer Name <email> 1571305500 +0200
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				seconds, _ := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+				commit.Time = time.Unix(seconds, 0).UTC()
+			}
+		}
+	}
+	return commit, nil
+}
+
+// Walk visits commits reachable from the sha in breadth-first order, until the visitor returns false.
+// Parents of the commits listed in .git/shallow are not visited, as shallow clones don't have them.
+func (r *GitRepository) Walk(sha string, visit func(commit GitCommit, depth int) bool) error {
+	type item struct {
+		sha   string
+		depth int
+	}
+	queue := []item{{sha, 0}}
+	seen := map[string]bool{sha: true}
+	shallow := r.shallowCommits()
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		commit, err := r.Commit(current.sha)
+		if err != nil {
+			return err
+		}
+		if !visit(commit, current.depth) {
+			return nil
+		}
+		if shallow[commit.Sha] {
+			continue
+		}
+		for _, parent := range commit.Parents {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, item{parent, current.depth + 1})
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the commits listed in .git/shallow
+func (r *GitRepository) shallowCommits() map[string]bool {
+	shallow := map[string]bool{}
+	if content, err := ioutil.ReadFile(filepath.Join(r.commonDir, "shallow")); err == nil {
+		for _, line := range strings.Fields(string(content)) {
+			shallow[line] = true
+		}
+	}
+	return shallow
+}
+
+// Returns the header of the commit or tag object, which precedes the message
+func headerOf(data []byte) []byte {
+	if end := bytes.Index(data, []byte("\n\n")); end >= 0 {
+		return data[:end]
+	}
+	return data
+}
+
+func headerField(data []byte, name string) string {
+	for _, line := range strings.Split(string(headerOf(data)), "\n") {
+		if strings.HasPrefix(line, name+" ") {
+			return strings.TrimPrefix(line, name+" ")
+		}
+	}
+	return ""
+}
+
+//
+// OBJECTS
+//
+
+// ReadObject returns type ("commit", "tree", "blob" or "tag") and content of the object
+func (r *GitRepository) ReadObject(sha string) (string, []byte, error) {
+	if len(sha) != 40 {
+		return "", nil, fmt.Errorf("invalid object name %q", sha)
+	}
+
+	for _, dir := range r.objectDirs {
+		kind, data, err := readLooseObject(filepath.Join(dir, sha[:2], sha[2:]))
+		if err == nil {
+			return kind, data, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", nil, fmt.Errorf("failed to read object %s: %v", sha, err)
+		}
+	}
+
+	if err := r.loadPacks(); err != nil {
+		return "", nil, err
+	}
+	id, err := hex.DecodeString(sha)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid object name %q", sha)
+	}
+	for _, pack := range r.packs {
+		if offset, found := pack.find(id); found {
+			kind, data, err := pack.read(r, offset)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to read object %s: %v", sha, err)
+			}
+			return kind, data, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("object %s not found", sha)
+}
+
+// Reads zlib compressed "<type> <size>\0<content>"
+func readLooseObject(path string) (string, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	z, err := zlib.NewReader(file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+
+	content, err := ioutil.ReadAll(z)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nul := bytes.IndexByte(content, 0)
+	if nul < 0 {
+		return "", nil, errors.New("invalid object header")
+	}
+	header := strings.Fields(string(content[:nul]))
+	if len(header) != 2 {
+		return "", nil, errors.New("invalid object header")
+	}
+	return header[0], content[nul+1:], nil
+}
+
+var packObjectTypes = map[byte]string{1: "commit", 2: "tree", 3: "blob", 4: "tag"}
+
+const (
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// gitPack is a pack file together with its version 2 index
+type gitPack struct {
+	path    string
+	file    *os.File // Opened on the first read and kept open, as walks read thousands of objects
+	fanout  [256]uint32
+	ids     []byte // Sorted 20 bytes object names
+	offsets []byte // 4 bytes offsets, large ones reference 8 bytes offsets
+	large   []byte
+}
+
+func (r *GitRepository) loadPacks() error {
+	if r.packs != nil {
+		return nil
+	}
+	r.packs = []*gitPack{}
+
+	for _, dir := range r.objectDirs {
+		indexes, _ := filepath.Glob(filepath.Join(dir, "pack", "pack-*.idx"))
+		for _, index := range indexes {
+			pack, err := readPackIndex(index)
+			if err != nil {
+				return fmt.Errorf("failed to read pack index %s: %v", index, err)
+			}
+			r.packs = append(r.packs, pack)
+		}
+	}
+	return nil
+}
+
+func readPackIndex(path string) (*gitPack, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < 8+256*4 || !bytes.Equal(content[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(content[4:8]) != 2 {
+		return nil, errors.New("unsupported pack index version")
+	}
+
+	pack := &gitPack{path: strings.TrimSuffix(path, ".idx") + ".pack"}
+	for i := 0; i < 256; i++ {
+		pack.fanout[i] = binary.BigEndian.Uint32(content[8+i*4:])
+	}
+
+	count := int(pack.fanout[255])
+	start := 8 + 256*4
+	if len(content) < start+count*(20+4+4) {
+		return nil, errors.New("truncated pack index")
+	}
+	pack.ids = content[start : start+count*20]
+	pack.offsets = content[start+count*24 : start+count*28]
+	pack.large = content[start+count*28:]
+	return pack, nil
+}
+
+// Finds offset of the object in the pack
+func (p *gitPack) find(id []byte) (int64, bool) {
+	lo := 0
+	if id[0] > 0 {
+		lo = int(p.fanout[id[0]-1])
+	}
+	hi := int(p.fanout[id[0]])
+
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.ids[(lo+i)*20:(lo+i+1)*20], id) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.ids[i*20:(i+1)*20], id) {
+		return 0, false
+	}
+
+	offset := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if offset&0x80000000 != 0 {
+		index := int(offset & 0x7fffffff)
+		return int64(binary.BigEndian.Uint64(p.large[index*8:])), true
+	}
+	return int64(offset), true
+}
+
+// Reads the object at the offset, applying deltas if needed
+func (p *gitPack) read(repo *GitRepository, offset int64) (string, []byte, error) {
+	if p.file == nil {
+		file, err := os.Open(p.path)
+		if err != nil {
+			return "", nil, err
+		}
+		p.file = file
+	}
+	return p.readAt(repo, p.file, offset, 0)
+}
+
+func (p *gitPack) readAt(repo *GitRepository, file *os.File, offset int64, depth int) (string, []byte, error) {
+	if depth > 64 {
+		return "", nil, errors.New("delta chain is too long")
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, 1<<62))
+
+	// Type and size header: 1MSB continuation, 3 bits type, 4 bits size, followed by 7 bits size chunks
+	b, err := reader.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	kind := (b >> 4) & 7
+	for b&0x80 != 0 {
+		if b, err = reader.ReadByte(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	var baseKind string
+	var base []byte
+	switch kind {
+	case packOfsDelta:
+		// Negative offset of the base object, where each continuation adds one
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		distance := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = reader.ReadByte(); err != nil {
+				return "", nil, err
+			}
+			distance = ((distance + 1) << 7) | int64(b&0x7f)
+		}
+		if baseKind, base, err = p.readAt(repo, file, offset-distance, depth+1); err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		id := make([]byte, 20)
+		if _, err := io.ReadFull(reader, id); err != nil {
+			return "", nil, err
+		}
+		if baseKind, base, err = repo.ReadObject(hex.EncodeToString(id)); err != nil {
+			return "", nil, err
+		}
+	}
+
+	z, err := zlib.NewReader(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	defer z.Close()
+	data, err := ioutil.ReadAll(z)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if base == nil {
+		name, found := packObjectTypes[kind]
+		if !found {
+			return "", nil, fmt.Errorf("unknown object type %d", kind)
+		}
+		return name, data, nil
+	}
+
+	data, err = applyDelta(base, data)
+	return baseKind, data, err
+}
+
+// Applies git delta: source and target sizes followed by copy and insert instructions
+func applyDelta(base []byte, delta []byte) ([]byte, error) {
+	readSize := func() int {
+		size, shift := 0, uint(0)
+		for len(delta) > 0 {
+			b := delta[0]
+			delta = delta[1:]
+			size |= int(b&0x7f) << shift
+			shift += 7
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		return size
+	}
+
+	if readSize() != len(base) {
+		return nil, errors.New("delta base size mismatch")
+	}
+	target := make([]byte, 0, readSize())
+
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		if op&0x80 == 0 {
+			// Insert the next op bytes
+			if op == 0 || int(op) > len(delta) {
+				return nil, errors.New("invalid delta instruction")
+			}
+			target = append(target, delta[:op]...)
+			delta = delta[op:]
+			continue
+		}
+
+		// Copy from the base: bits 0-3 select offset bytes, bits 4-6 select size bytes
+		var offset, size int
+		for i := uint(0); i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, errors.New("truncated delta instruction")
+			}
+			if i < 4 {
+				offset |= int(delta[0]) << (8 * i)
+			} else {
+				size |= int(delta[0]) << (8 * (i - 4))
+			}
+			delta = delta[1:]
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(base) {
+			return nil, errors.New("delta copy out of bounds")
+		}
+		target = append(target, base[offset:offset+size]...)
+	}
+
+	return target, nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+// Creates the git repository in a temporary directory, commands are run with git binary
+func gitFixture(t *testing.T) (string, func(args ...string) string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary is not available")
+	}
+
+	dir, cleanup := tempDir(t)
+	git := func(args ...string) string {
+		return runGit(t, dir, args...)
+	}
+	git("init", "-q", "-b", "main")
+	return dir, git, cleanup
+}
+
+// Runs git in the directory with fixed identity and dates, so that the shas are stable
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null", "HOME="+dir,
+		"GIT_AUTHOR_NAME=mkver", "GIT_AUTHOR_EMAIL=mkver@example.com", "GIT_AUTHOR_DATE=2019-10-17T10:00:00Z",
+		"GIT_COMMITTER_NAME=mkver", "GIT_COMMITTER_EMAIL=mkver@example.com", "GIT_COMMITTER_DATE=2019-10-17T10:00:00Z")
+	out, err := cmd.CombinedOutput()
+	assert.NilError(t, err, "git %s: %s", strings.Join(args, " "), out)
+	return strings.TrimSpace(string(out))
+}
+
+func openFixture(t *testing.T, dir string) *GitRepository {
+	repo, err := OpenGitRepository(dir)
+	assert.NilError(t, err)
+	return repo
+}
+
+// Compares every object of the repository with git cat-file
+func assertObjects(t *testing.T, git func(args ...string) string, repo *GitRepository) {
+	for _, line := range strings.Split(git("cat-file", "--batch-all-objects", "--batch-check"), "\n") {
+		fields := strings.Fields(line) // sha type size
+		kind, data, err := repo.ReadObject(fields[0])
+		assert.NilError(t, err, "failed while reading "+line)
+		assert.Equal(t, fields[1], kind, "failed while reading "+line)
+		assert.Equal(t, fields[2], strconv.Itoa(len(data)), "failed while reading "+line)
+		if kind == "blob" {
+			assert.Equal(t, git("cat-file", "-p", fields[0]), strings.TrimSpace(string(data)), "failed while reading "+line)
+		}
+	}
+}
+
+func TestGitRepository(t *testing.T) {
+	dir, git, cleanup := gitFixture(t)
+	defer cleanup()
+
+	// Large file with small changes, so that repack stores deltas
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, "line "+strconv.Itoa(i))
+	}
+	for i := 0; i < 5; i++ {
+		lines[i*10] = "changed " + strconv.Itoa(i)
+		writeFile(t, filepath.Join(dir, "file.txt"), strings.Join(lines, "\n"))
+		git("add", "file.txt")
+		git("commit", "-q", "-m", "commit "+strconv.Itoa(i))
+	}
+	git("tag", "v1.0.0", "HEAD~2")
+	git("tag", "-a", "-m", "release", "v1.1.0")
+
+	check := func(stage string) {
+		repo := openFixture(t, filepath.Join(dir, "file.txt", ".."))
+
+		branch, sha, err := repo.Head()
+		assert.NilError(t, err, stage)
+		assert.Equal(t, "main", branch, stage)
+		assert.Equal(t, git("rev-parse", "HEAD"), sha, stage)
+
+		tags, err := repo.Tags()
+		assert.NilError(t, err, stage)
+		assert.DeepEqual(t, map[string][]string{
+			git("rev-parse", "HEAD~2"): {"v1.0.0"},
+			git("rev-parse", "HEAD"):   {"v1.1.0"}, // annotated tags are peeled to the commit
+		}, tags)
+
+		commit, err := repo.Commit(sha)
+		assert.NilError(t, err, stage)
+		assert.DeepEqual(t, []string{git("rev-parse", "HEAD~1")}, commit.Parents)
+		assert.Equal(t, "2019-10-17T10:00:00Z", commit.Time.Format("2006-01-02T15:04:05Z07:00"), stage)
+
+		var walked []string
+		assert.NilError(t, repo.Walk(sha, func(commit GitCommit, depth int) bool {
+			walked = append(walked, commit.Sha)
+			return true
+		}))
+		assert.DeepEqual(t, strings.Split(git("rev-list", "HEAD"), "\n"), walked)
+
+		assertObjects(t, git, repo)
+
+		assert.NilError(t, repo.Close(), stage)
+		for _, pack := range repo.packs {
+			assert.Assert(t, pack.file == nil, stage)
+		}
+		assertObjects(t, git, repo) // reopens the closed pack files
+		assert.NilError(t, repo.Close(), stage)
+	}
+
+	check("loose")
+	git("pack-refs", "--all")
+	check("packed refs")
+	git("repack", "-adq", "--depth=10", "--window=10")
+	check("packed objects")
+
+	git("checkout", "-q", "--detach", "HEAD~1")
+	branch, sha, err := openFixture(t, dir).Head()
+	assert.NilError(t, err)
+	assert.Equal(t, "", branch)
+	assert.Equal(t, git("rev-parse", "HEAD"), sha)
+}
+
+func TestGitWorktree(t *testing.T) {
+	dir, git, cleanup := gitFixture(t)
+	defer cleanup()
+
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+	git("worktree", "add", "-q", "-b", "feature/x", filepath.Join(dir, "worktree"))
+	runGit(t, filepath.Join(dir, "worktree"), "commit", "-q", "--allow-empty", "-m", "feature")
+
+	repo := openFixture(t, filepath.Join(dir, "worktree"))
+	assert.Equal(t, filepath.Join(dir, "worktree"), repo.WorkTree())
+
+	branch, sha, err := repo.Head()
+	assert.NilError(t, err)
+	assert.Equal(t, "feature/x", branch)
+	assert.Equal(t, git("rev-parse", "feature/x"), sha)
+
+	// Main working tree is not affected
+	branch, _, err = openFixture(t, dir).Head()
+	assert.NilError(t, err)
+	assert.Equal(t, "main", branch)
+}
+
+func TestNotGitRepository(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	_, err := OpenGitRepository(dir)
+	assert.Equal(t, ErrNotGitRepository, err)
+}
+
+func TestGitStatus(t *testing.T) {
+	dir, git, cleanup := gitFixture(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(dir, ".gitignore"), "*.log\nbuild/\n")
+	writeFile(t, filepath.Join(dir, "modified.txt"), "a")
+	writeFile(t, filepath.Join(dir, "staged.txt"), "a")
+	writeFile(t, filepath.Join(dir, "deleted.txt"), "a")
+	writeFile(t, filepath.Join(dir, "removed.txt"), "a")
+	writeFile(t, filepath.Join(dir, "src", "kept.txt"), "a")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+
+	status := func() []string {
+		changes, err := openFixture(t, dir).Status()
+		assert.NilError(t, err)
+		var result []string
+		for _, change := range changes {
+			result = append(result, change.String())
+		}
+		return result
+	}
+	porcelain := func() []string {
+		out := git("status", "--porcelain", "--untracked-files=all")
+		if len(out) == 0 {
+			return nil
+		}
+		result := strings.Split(out, "\n")
+		sort.Slice(result, func(i, j int) bool { return result[i][3:] < result[j][3:] })
+		return result
+	}
+
+	assert.DeepEqual(t, []string(nil), status())
+
+	writeFile(t, filepath.Join(dir, "modified.txt"), "changed")
+	writeFile(t, filepath.Join(dir, "staged.txt"), "changed")
+	git("add", "staged.txt")
+	assert.NilError(t, os.Remove(filepath.Join(dir, "deleted.txt")))
+	git("rm", "-q", "removed.txt")
+	writeFile(t, filepath.Join(dir, "added.txt"), "b")
+	git("add", "added.txt")
+	writeFile(t, filepath.Join(dir, "untracked.txt"), "a")
+	writeFile(t, filepath.Join(dir, "src", "new.txt"), "a")
+	writeFile(t, filepath.Join(dir, "debug.log"), "a")
+	writeFile(t, filepath.Join(dir, "build", "out.txt"), "a")
+
+	expected := []string{
+		"A  added.txt",
+		" D deleted.txt",
+		" M modified.txt",
+		"D  removed.txt",
+		"?? src/new.txt",
+		"M  staged.txt",
+		"?? untracked.txt",
+	}
+	assert.DeepEqual(t, expected, status())
+	assert.DeepEqual(t, expected, porcelain())
+
+	// Index v4 compresses the paths
+	git("update-index", "--index-version", "4")
+	assert.DeepEqual(t, expected, status())
+}
+
+func TestGitStatusExcludes(t *testing.T) {
+	dir, git, cleanup := gitFixture(t)
+	defer cleanup()
+
+	// Global excludes come from $XDG_CONFIG_HOME/git/ignore, unless core.excludesFile is configured
+	for name, value := range map[string]string{"HOME": dir, "XDG_CONFIG_HOME": filepath.Join(dir, "xdg"), "GIT_CONFIG_GLOBAL": "", "GIT_CONFIG_NOSYSTEM": "1"} {
+		original, found := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if found {
+			defer os.Setenv(name, original)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+	writeFile(t, filepath.Join(dir, "xdg", "git", "ignore"), "xdg/\n*.xdg\n")
+	writeFile(t, filepath.Join(dir, ".gitconfig"), "[user]\n\tname = mkver\n[Core]\n\texcludesFile = \"~/global ignore\" # comment\n")
+	writeFile(t, filepath.Join(dir, "global ignore"), "global ignore\n.gitconfig\n*.global\n")
+
+	writeFile(t, filepath.Join(dir, "a.xdg"), "a")
+	writeFile(t, filepath.Join(dir, "a.global"), "a")
+	writeFile(t, filepath.Join(dir, "skipped.txt"), "a")
+	writeFile(t, filepath.Join(dir, "assumed.txt"), "a")
+	git("add", "skipped.txt", "assumed.txt")
+	git("commit", "-q", "-m", "initial")
+	git("update-index", "--skip-worktree", "skipped.txt")
+	git("update-index", "--assume-unchanged", "assumed.txt")
+	writeFile(t, filepath.Join(dir, "skipped.txt"), "changed")
+	writeFile(t, filepath.Join(dir, "assumed.txt"), "changed")
+
+	changes, err := openFixture(t, dir).Status()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []GitChange{{Status: "??", Path: "a.xdg"}, {Status: "??", Path: "xdg/git/ignore"}}, changes)
+
+	// Without core.excludesFile
+	assert.NilError(t, os.Remove(filepath.Join(dir, ".gitconfig")))
+	changes, err = openFixture(t, dir).Status()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []GitChange{{Status: "??", Path: "a.global"}, {Status: "??", Path: "global ignore"}}, changes)
+}
+
+func TestGitUnbornHead(t *testing.T) {
+	dir, _, cleanup := gitFixture(t)
+	defer cleanup()
+
+	repo := openFixture(t, dir)
+	branch, sha, err := repo.Head()
+	assert.NilError(t, err)
+	assert.Equal(t, "main", branch)
+	assert.Equal(t, "", sha)
+
+	writeFile(t, filepath.Join(dir, "new.txt"), "a")
+	changes, err := repo.Status()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []GitChange{{Status: "??", Path: "new.txt"}}, changes)
+
+	_, err = repo.Describe("v")
+	assert.ErrorContains(t, err, "no commits yet")
+}
+
+func TestNearestBranch(t *testing.T) {
+	dir, git, cleanup := gitFixture(t)
+	defer cleanup()
+
+	// main:      1 - 2 - 3
+	// feature/x:      \- f1 - f2
+	// origin/release/1.0 points to 2
+	git("commit", "-q", "--allow-empty", "-m", "1")
+	git("commit", "-q", "--allow-empty", "-m", "2")
+	git("update-ref", "refs/remotes/origin/release/1.0", "HEAD")
+	git("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/release/1.0")
+	git("checkout", "-q", "-b", "feature/x")
+	git("commit", "-q", "--allow-empty", "-m", "f1")
+	git("commit", "-q", "--allow-empty", "-m", "f2")
+	git("checkout", "-q", "main")
+	git("commit", "-q", "--allow-empty", "-m", "3")
+	git("checkout", "-q", "--orphan", "orphan")
+	git("commit", "-q", "--allow-empty", "-m", "orphan")
+	orphan := git("rev-parse", "HEAD")
+	git("checkout", "-q", "main")
+	git("branch", "-q", "-D", "orphan")
+
+	var tests = []struct {
+		name     string
+		rev      string
+		expected string
+		found    bool
+	}{
+		{"tip of local branch", "main", "main", true},
+		{"behind the tip", "feature/x~1", "feature/x", true},
+		{"tip of remote branch wins over the local one behind", "main~1", "release/1.0", true},
+		{"closest tip wins", "main~2", "release/1.0", true},
+		{"unreachable", orphan, "", false},
+	}
+
+	repo := openFixture(t, dir)
+	for _, test := range tests {
+		sha := test.rev
+		if len(sha) != 40 {
+			sha = git("rev-parse", test.rev)
+		}
+		got, found, err := repo.NearestBranch(sha)
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, test.found, found, "failed while testing "+test.name)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
+	}
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GitChange is a path, which differs between HEAD, index and working tree
+// Status follows "git status --porcelain": "M " staged, " M" not staged, "??" untracked, etc.
+type GitChange struct {
+	Status string
+	Path   string
+}
+
+func (c GitChange) String() string {
+	return c.Status + " " + c.Path
+}
+
+// Status lists staged, not staged and untracked changes, ignored files are skipped
+func (r *GitRepository) Status() ([]GitChange, error) {
+	index, err := r.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	head := map[string]gitTreeEntry{}
+	if _, sha, err := r.Head(); err == nil && len(sha) > 0 {
+		kind, data, err := r.ReadObject(sha)
+		if err != nil {
+			return nil, err
+		}
+		if kind != "commit" {
+			return nil, fmt.Errorf("HEAD %s is not a commit", sha)
+		}
+		if err := r.readTree(headerField(data, "tree"), "", head); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := map[string][]byte{}
+	mark := func(path string, staged, unstaged byte) {
+		status, found := changes[path]
+		if !found {
+			status = []byte{' ', ' '}
+		}
+		if staged != ' ' {
+			status[0] = staged
+		}
+		if unstaged != ' ' {
+			status[1] = unstaged
+		}
+		changes[path] = status
+	}
+
+	tracked := map[string]bool{}
+	for _, entry := range index {
+		tracked[entry.path] = true
+
+		// Unmerged paths have several stages
+		if entry.stage != 0 {
+			mark(entry.path, 'U', 'U')
+			continue
+		}
+
+		// Index vs HEAD
+		if committed, found := head[entry.path]; !found {
+			mark(entry.path, 'A', ' ')
+		} else if committed.sha != entry.sha || committed.mode != entry.mode {
+			mark(entry.path, 'M', ' ')
+		}
+
+		// Working tree vs index
+		if entry.unchecked {
+			continue
+		}
+		if modified, deleted := r.worktreeChanged(entry); deleted {
+			mark(entry.path, ' ', 'D')
+		} else if modified {
+			mark(entry.path, ' ', 'M')
+		}
+	}
+	for path := range head {
+		if !tracked[path] {
+			mark(path, 'D', ' ')
+		}
+	}
+
+	untracked, err := r.untracked(tracked)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range untracked {
+		changes[path] = []byte("??")
+	}
+
+	result := make([]GitChange, 0, len(changes))
+	for path, status := range changes {
+		result = append(result, GitChange{Status: string(status), Path: path})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+//
+// INDEX
+//
+
+type gitIndexEntry struct {
+	path      string
+	sha       string
+	mode      uint32
+	size      uint32
+	mtime     int64
+	mtimeNano int64
+	stage     int
+	unchecked bool // Either assume-unchanged or skip-worktree, the working tree is never compared
+}
+
+const (
+	gitModeSymlink = 0120000
+	gitModeGitlink = 0160000
+	gitModeTree    = 040000
+)
+
+// Reads the index of version 2, 3 or 4
+func (r *GitRepository) readIndex() ([]gitIndexEntry, error) {
+	content, err := ioutil.ReadFile(filepath.Join(r.gitDir, "index"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < 12 || string(content[:4]) != "DIRC" {
+		return nil, errors.New("invalid git index")
+	}
+
+	version := binary.BigEndian.Uint32(content[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported git index version %d", version)
+	}
+	count := int(binary.BigEndian.Uint32(content[8:12]))
+
+	entries := make([]gitIndexEntry, 0, count)
+	data := content[12:]
+	var previous string
+	for i := 0; i < count; i++ {
+		if len(data) < 62 {
+			return nil, errors.New("truncated git index")
+		}
+
+		entry := gitIndexEntry{
+			mtime:     int64(binary.BigEndian.Uint32(data[8:12])),
+			mtimeNano: int64(binary.BigEndian.Uint32(data[12:16])),
+			mode:      binary.BigEndian.Uint32(data[24:28]),
+			size:      binary.BigEndian.Uint32(data[36:40]),
+			sha:       hex.EncodeToString(data[40:60]),
+		}
+		flags := binary.BigEndian.Uint16(data[60:62])
+		entry.stage = int(flags>>12) & 3
+
+		entry.unchecked = flags&0x8000 != 0
+
+		headerLen := 62
+		if version >= 3 && flags&0x4000 != 0 {
+			headerLen += 2
+		}
+		if len(data) < headerLen {
+			return nil, errors.New("truncated git index")
+		}
+		if headerLen > 62 && binary.BigEndian.Uint16(data[62:64])&0x4000 != 0 {
+			entry.unchecked = true
+		}
+
+		if version == 4 {
+			// Path is prefix compressed: number of bytes to strip from the previous path, then NUL-terminated suffix
+			rest := data[headerLen:]
+			strip, n := readOffsetVarint(rest)
+			if n == 0 || strip > len(previous) {
+				return nil, errors.New("invalid git index path")
+			}
+			nul := bytes.IndexByte(rest[n:], 0)
+			if nul < 0 {
+				return nil, errors.New("invalid git index path")
+			}
+			entry.path = previous[:len(previous)-strip] + string(rest[n:n+nul])
+			data = rest[n+nul+1:]
+		} else {
+			// Path is NUL-terminated and the entry is padded to the multiple of 8 bytes
+			nul := bytes.IndexByte(data[headerLen:], 0)
+			if nul < 0 {
+				return nil, errors.New("invalid git index path")
+			}
+			entry.path = string(data[headerLen : headerLen+nul])
+			size := (headerLen + nul + 8) &^ 7
+			if size > len(data) {
+				return nil, errors.New("truncated git index")
+			}
+			data = data[size:]
+		}
+
+		previous = entry.path
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Reads the variable length integer, where each continuation adds one (same as offsets of OFS_DELTA)
+func readOffsetVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	value := int(data[0] & 0x7f)
+	n := 1
+	for data[n-1]&0x80 != 0 {
+		if n >= len(data) {
+			return 0, 0
+		}
+		value = ((value + 1) << 7) | int(data[n]&0x7f)
+		n++
+	}
+	return value, n
+}
+
+// Compares the file in the working tree with its index entry
+func (r *GitRepository) worktreeChanged(entry gitIndexEntry) (bool, bool) {
+	if entry.mode == gitModeGitlink {
+		return false, false
+	}
+
+	path := filepath.Join(r.workTree, filepath.FromSlash(entry.path))
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, true
+	}
+
+	if entry.mode == gitModeSymlink {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return true, false
+		}
+		target, err := os.Readlink(path)
+		return err != nil || hashBlob([]byte(filepath.ToSlash(target))) != entry.sha, false
+	}
+
+	if !info.Mode().IsRegular() {
+		return true, false
+	}
+	if executable := info.Mode()&0111 != 0; executable != (entry.mode&0111 != 0) {
+		return true, false
+	}
+	if uint32(info.Size()) != entry.size {
+		return true, false
+	}
+	if mtime := info.ModTime(); mtime.Unix() == entry.mtime && int64(mtime.Nanosecond()) == entry.mtimeNano {
+		return false, false
+	}
+
+	// Stat information differs, compare the content
+	content, err := ioutil.ReadFile(path)
+	return err != nil || hashBlob(content) != entry.sha, false
+}
+
+// Computes the object name of the blob with the content
+func hashBlob(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//
+// TREES
+//
+
+type gitTreeEntry struct {
+	sha  string
+	mode uint32
+}
+
+// Flattens the tree into the paths of its files
+func (r *GitRepository) readTree(sha string, prefix string, entries map[string]gitTreeEntry) error {
+	kind, data, err := r.ReadObject(sha)
+	if err != nil {
+		return err
+	}
+	if kind != "tree" {
+		return fmt.Errorf("object %s is a %s, not a tree", sha, kind)
+	}
+
+	// Entries are "<mode> <name>\0<20 bytes sha>"
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space < 0 || nul < space || nul+21 > len(data) {
+			return fmt.Errorf("invalid tree object %s", sha)
+		}
+		mode, _ := strconv.ParseUint(string(data[:space]), 8, 32)
+		name := path.Join(prefix, string(data[space+1:nul]))
+		entrySha := hex.EncodeToString(data[nul+1 : nul+21])
+		data = data[nul+21:]
+
+		if mode == gitModeTree {
+			if err := r.readTree(entrySha, name, entries); err != nil {
+				return err
+			}
+			continue
+		}
+		entries[name] = gitTreeEntry{sha: entrySha, mode: uint32(mode)}
+	}
+	return nil
+}
+
+//
+// UNTRACKED
+//
+
+// Walks the working tree looking for the files, which are neither tracked nor ignored
+func (r *GitRepository) untracked(tracked map[string]bool) ([]string, error) {
+	var result []string
+
+	// Patterns of the later files take precedence: global excludes, info/exclude, .gitignore files
+	ignore := &gitIgnore{}
+	ignore.load(r.excludesFile(), "")
+	ignore.load(filepath.Join(r.commonDir, "info", "exclude"), "")
+
+	// Directories containing tracked files, which are never reported as a whole
+	trackedDirs := map[string]bool{}
+	for p := range tracked {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+
+	err := filepath.Walk(r.workTree, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(r.workTree, file)
+		rel = filepath.ToSlash(rel)
+
+		if rel == "." {
+			ignore.load(filepath.Join(file, ".gitignore"), "")
+			return nil
+		}
+		if info.Name() == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if tracked[rel] || ignore.match(rel, true) {
+				return filepath.SkipDir
+			}
+			// Nested repositories are reported as a single untracked directory
+			if _, err := os.Stat(filepath.Join(file, ".git")); err == nil && !trackedDirs[rel] {
+				result = append(result, rel+"/")
+				return filepath.SkipDir
+			}
+			ignore.load(filepath.Join(file, ".gitignore"), rel)
+			return nil
+		}
+
+		if !tracked[rel] && !ignore.match(rel, false) {
+			result = append(result, rel)
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// Returns core.excludesFile of git config, "$XDG_CONFIG_HOME/git/ignore" by default
+func (r *GitRepository) excludesFile() string {
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if len(xdg) == 0 && len(home) > 0 {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	// System, global and repository config, the last value wins
+	var configs []string
+	if len(os.Getenv("GIT_CONFIG_NOSYSTEM")) == 0 {
+		configs = append(configs, "/etc/gitconfig")
+	}
+	if global := os.Getenv("GIT_CONFIG_GLOBAL"); len(global) > 0 {
+		configs = append(configs, global)
+	} else {
+		if len(xdg) > 0 {
+			configs = append(configs, filepath.Join(xdg, "git", "config"))
+		}
+		if len(home) > 0 {
+			configs = append(configs, filepath.Join(home, ".gitconfig"))
+		}
+	}
+	configs = append(configs, filepath.Join(r.commonDir, "config"))
+
+	var file string
+	for _, config := range configs {
+		if value, found := readGitConfig(config, "core", "excludesfile"); found {
+			file = value
+		}
+	}
+
+	switch {
+	case file == "~" || strings.HasPrefix(file, "~/"):
+		return filepath.Join(home, file[1:])
+	case len(file) > 0:
+		return file
+	case len(xdg) > 0:
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	return ""
+}
+
+// Reads the value of the key in the section of git config file, f.e. "[core] excludesFile = ~/.gitignore".
+// Sections and keys are case-insensitive, includes and subsections are not supported.
+func readGitConfig(file string, section string, key string) (string, bool) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	var value string
+	var found bool
+	var current string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			if end := strings.IndexByte(line, ']'); end > 0 {
+				current = strings.ToLower(strings.TrimSpace(line[1:end]))
+				line = strings.TrimSpace(line[end+1:])
+			}
+			if len(line) == 0 {
+				continue
+			}
+		}
+		if current != section {
+			continue
+		}
+
+		name, rest := line, ""
+		if eq := strings.IndexByte(line, '='); eq >= 0 {
+			name, rest = line[:eq], line[eq+1:]
+		}
+		if !strings.EqualFold(strings.TrimSpace(name), key) {
+			continue
+		}
+		value, found = parseGitConfigValue(rest), true
+	}
+	return value, found
+}
+
+// Strips comments and quotes of the value, f.e. `"~/my ignore" # global` => "~/my ignore"
+func parseGitConfigValue(raw string) string {
+	var value strings.Builder
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 't':
+				value.WriteByte('\t')
+			case 'n':
+				value.WriteByte('\n')
+			default:
+				value.WriteByte(raw[i])
+			}
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(value.String())
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(value.String())
+}
+
+// gitIgnore matches paths against the patterns of .gitignore files, the last matching pattern wins
+type gitIgnore struct {
+	patterns []gitIgnorePattern
+}
+
+type gitIgnorePattern struct {
+	base     string // Directory of .gitignore relative to the working tree
+	regexp   *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	anchored bool // Pattern containing "/" matches path relative to base, otherwise - name only
+}
+
+func (g *gitIgnore) load(file string, base string) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if pattern, ok := parseGitIgnorePattern(scanner.Text(), base); ok {
+			g.patterns = append(g.patterns, pattern)
+		}
+	}
+}
+
+func parseGitIgnorePattern(line string, base string) (gitIgnorePattern, bool) {
+	p := gitIgnorePattern{base: base}
+
+	line = strings.TrimRight(line, " \t\r")
+	if len(line) == 0 || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if len(line) == 0 {
+		return p, false
+	}
+
+	re, err := regexp.Compile("^" + globToRegexp(line) + "$")
+	if err != nil {
+		return p, false
+	}
+	p.regexp = re
+	return p, true
+}
+
+// Converts gitignore glob into regular expression: "**" matches across directories, "*" and "?" - within one
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			if end := strings.IndexByte(glob[i+1:], ']'); end >= 0 {
+				class := glob[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + class + "]")
+				i += end + 1
+			} else {
+				b.WriteString("\\[")
+			}
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+func (g *gitIgnore) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range g.patterns {
+		target := rel
+		if len(p.base) > 0 {
+			if !strings.HasPrefix(rel, p.base+"/") {
+				continue
+			}
+			target = rel[len(p.base)+1:]
+		}
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if !p.anchored {
+			target = path.Base(target)
+		}
+		if p.regexp.MatchString(target) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GitDescription describes the position of HEAD relative to the nearest reachable version tag
+type GitDescription struct {
+	Tag      string // Tag as is, f.e. service-a/v1.4.2
+	Version  SemVer // Version of the tag without prefix, f.e. 1.4.2
+	Distance int    // Number of commits since the tag
+	Sha      string // Abbreviated sha of HEAD
+}
+
+// Exact reports whether HEAD is exactly on the tag
+func (d GitDescription) Exact() bool {
+	return d.Distance == 0
+}
+
+// GitTagModes define how the version is derived from the tag, when HEAD is not exactly on it
+var GitTagModes = []string{"describe", "next-patch", "tag"}
+
+// VersionFor derives the version from the tag:
+// "describe" => 1.4.2-3-gabc123, "next-patch" => 1.4.3-dev.3, "tag" => 1.4.2.
+// The version of the tag is used as is, if HEAD is exactly on it.
+func (d GitDescription) VersionFor(mode string) (string, error) {
+	version := d.Version
+	if d.Exact() {
+		return version.String(), nil
+	}
+
+	switch mode {
+	case "", "describe":
+		version.AppendQualifier(fmt.Sprintf("%d-g%s", d.Distance, d.Sha))
+	case "next-patch":
+		version = version.IncPatch()
+		version.Prerelease = []string{"dev", strconv.Itoa(d.Distance)}
+	case "tag":
+	default:
+		return "", fmt.Errorf("Unknown git tag mode %q, available modes: %s", mode, strings.Join(GitTagModes, ", "))
+	}
+	return version.String(), nil
+}
+
+// Finds the nearest tag reachable from HEAD, which consists of the prefix followed by the version
+// F.e. prefix "v" matches v1.4.2, prefix "service-a/" matches service-a/1.4.2
+func describeGitTag(prefix string) (GitDescription, error) {
+	var d GitDescription
+
+	repo, err := openGitRepository()
+	if err != nil {
+		return d, fmt.Errorf("Failed to resolve version from git tags: %v", err)
+	}
+	defer repo.Close()
+	if d, err = repo.Describe(prefix); err != nil {
+		return d, fmt.Errorf("Failed to resolve version from git tags: %v", err)
+	}
+	return d, nil
+}
+
+// Describe finds the nearest tag reachable from HEAD, which consists of the prefix followed by a semantic version.
+// The highest version wins, when a commit has several matching tags.
+func (r *GitRepository) Describe(prefix string) (GitDescription, error) {
+	var d GitDescription
+
+	_, head, err := r.Head()
+	if err != nil {
+		return d, err
+	}
+	if len(head) == 0 {
+		return d, fmt.Errorf("no tag matching %s* is reachable from HEAD, the branch has no commits yet", prefix)
+	}
+
+	tags, err := r.Tags()
+	if err != nil {
+		return d, err
+	}
+
+	candidates := map[string]GitDescription{}
+	for sha, names := range tags {
+		for _, name := range names {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			version, err := ParseSemVerLenient(strings.TrimPrefix(name, prefix))
+			if err != nil {
+				continue
+			}
+			if current, found := candidates[sha]; !found || version.Compare(current.Version) > 0 {
+				candidates[sha] = GitDescription{Tag: name, Version: version}
+			}
+		}
+	}
+
+	var tagged string
+	err = r.Walk(head, func(commit GitCommit, depth int) bool {
+		if _, found := candidates[commit.Sha]; found {
+			tagged = commit.Sha
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return d, err
+	}
+	if len(tagged) == 0 {
+		return d, fmt.Errorf("no tag matching %s* is reachable from HEAD", prefix)
+	}
+
+	// Distance is the number of commits reachable from HEAD, but not from the tag
+	released := map[string]bool{}
+	if err := r.Walk(tagged, func(commit GitCommit, depth int) bool {
+		released[commit.Sha] = true
+		return true
+	}); err != nil {
+		return d, err
+	}
+
+	d = candidates[tagged]
+	d.Sha = head[:7]
+	err = r.Walk(head, func(commit GitCommit, depth int) bool {
+		if !released[commit.Sha] {
+			d.Distance++
+		}
+		return true
+	})
+	return d, err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+var GitTagTests = []struct {
+	name     string
+	prefix   string
+	mode     string
+	expected string
+	err      string
+}{
+	{"describe", "v", "describe", "1.4.2-4-g{sha}", ""},
+	{"describe: default mode", "v", "", "1.4.2-4-g{sha}", ""},
+	{"next-patch", "v", "next-patch", "1.4.3-dev.4", ""},
+	{"tag", "v", "tag", "1.4.2", ""},
+	{"monorepo prefix", "service-a/", "describe", "2.0.0-rc.1-3-g{sha}", ""},
+	{"no tags", "release-", "describe", "", "no tag matching release-* is reachable from HEAD"},
+	{"unknown mode", "v", "latest", "", "Unknown git tag mode \"latest\""},
+}
+
+func TestGitTag(t *testing.T) {
+	dir, git, cleanup := gitFixture(t)
+	defer cleanup()
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	assert.NilError(t, os.Chdir(dir))
+
+	// main:    1 (v1.4.2, vnext) - 2 (service-a/2.0.0-rc.1) - 3 - merge (HEAD)
+	// feature:  \- f ----------------------------------------/
+	git("commit", "-q", "--allow-empty", "-m", "1")
+	git("tag", "v1.4.2")
+	git("tag", "vnext") // not a version, skipped
+	git("checkout", "-q", "-b", "feature")
+	git("commit", "-q", "--allow-empty", "-m", "f")
+	git("checkout", "-q", "main")
+	git("commit", "-q", "--allow-empty", "-m", "2")
+	git("tag", "-a", "-m", "rc", "service-a/2.0.0-rc.1")
+	git("commit", "-q", "--allow-empty", "-m", "3")
+	git("merge", "-q", "--no-ff", "-m", "merge", "feature")
+
+	sha := git("rev-parse", "--short=7", "HEAD")
+	assert.Equal(t, "v1.4.2-4-g"+sha, git("describe", "--tags", "--long", "--match", "v[0-9]*"))
+
+	for _, test := range GitTagTests {
+		got, err := gitTagSource{}.Resolve(&Config{gitTagPrefix: test.prefix, gitTagMode: test.mode})
+		if len(test.err) > 0 {
+			assert.ErrorContains(t, err, test.err, "failed while testing "+test.name)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, strings.Replace(test.expected, "{sha}", sha, 1), got, "failed while testing "+test.name)
+	}
+
+	// Exactly on the tag, the highest version wins
+	git("tag", "v1.5.0-rc.1")
+	git("tag", "v1.5.0")
+	for _, mode := range GitTagModes {
+		got, err := gitTagSource{}.Resolve(&Config{gitTagPrefix: "v", gitTagMode: mode})
+		assert.NilError(t, err, "failed while testing exact "+mode)
+		assert.Equal(t, "1.5.0", got, "failed while testing exact "+mode)
+	}
+}
@@ -3,8 +3,10 @@ module github.com/titenkov/mkver
 go 1.12
 
 require (
-	github.com/google/go-cmp v0.3.0 // indirect
+	github.com/BurntSushi/toml v1.2.0
+	github.com/google/go-cmp v0.3.0
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/urfave/cli v1.20.0
+	gopkg.in/yaml.v2 v2.4.0
 	gotest.tools v2.2.0+incompatible
 )
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Pom contains the fields of pom.xml used for version resolution
+type Pom struct {
+	Version string `xml:"version"`
+	Parent  struct {
+		Version string `xml:"version"`
+	} `xml:"parent"`
+	Properties PomProperties `xml:"properties"`
+}
+
+// PomProperties are the arbitrary <properties> of the pom.xml
+type PomProperties map[string]string
+
+// UnmarshalXML reads every child element of <properties> as a property
+func (p *PomProperties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*p = PomProperties{}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var value string
+			if err := d.DecodeElement(&value, &t); err != nil {
+				return err
+			}
+			(*p)[t.Name.Local] = strings.TrimSpace(value)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+var pomPropertyRef = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// Resolves version from the pom.xml, the path can point either to the file or to the directory containing it.
+// Version is taken from project/version, falling back to project/parent/version,
+// with ${...} references resolved from <properties>.
+func resolvePomVersion(path string) (string, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "pom.xml")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve version from %s: %v", path, err)
+	}
+
+	var pom Pom
+	if err := xml.Unmarshal(content, &pom); err != nil {
+		return "", fmt.Errorf("Failed to parse %s: %v", path, err)
+	}
+
+	version := strings.TrimSpace(pom.Version)
+	if len(version) == 0 {
+		version = strings.TrimSpace(pom.Parent.Version)
+	}
+	if len(version) == 0 {
+		return "", fmt.Errorf("Failed to resolve version from %s: neither project nor parent version is declared", path)
+	}
+
+	version, err = pom.interpolate(version, nil)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve version from %s: %v", path, err)
+	}
+	return version, nil
+}
+
+// Replaces ${...} references with the values of properties, which may reference other properties as well
+func (pom Pom) interpolate(value string, chain []string) (string, error) {
+	var err error
+	result := pomPropertyRef.ReplaceAllStringFunc(value, func(ref string) string {
+		name := pomPropertyRef.FindStringSubmatch(ref)[1]
+		for _, seen := range chain {
+			if seen == name {
+				err = fmt.Errorf("property ${%s} references itself", name)
+				return ref
+			}
+		}
+
+		var resolved string
+		var found bool
+		switch name {
+		case "project.version", "version", "pom.version":
+			resolved, found = pom.Version, len(pom.Version) > 0
+		case "project.parent.version", "parent.version":
+			resolved, found = pom.Parent.Version, len(pom.Parent.Version) > 0
+		default:
+			resolved, found = pom.Properties[name]
+		}
+		if !found {
+			err = fmt.Errorf("property ${%s} is not defined", name)
+			return ref
+		}
+
+		resolved, e := pom.interpolate(resolved, append(chain, name))
+		if e != nil && err == nil {
+			err = e
+		}
+		return resolved
+	})
+	return result, err
+}
+
+var pomPropertyOnly = regexp.MustCompile(`^\$\{([^}]+)\}$`)
+
+// Replaces the version of pom.xml, changing project/version in place.
+// If the version is a single ${...} reference, f.e. ${revision}, the property is changed instead.
+func rewritePomVersion(path string, version string) (string, []byte, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "pom.xml")
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return path, nil, err
+	}
+	spans, err := pomElementSpans(content)
+	if err != nil {
+		return path, nil, fmt.Errorf("Failed to parse %s: %v", path, err)
+	}
+
+	span, found := spans["project/version"]
+	if !found {
+		return path, nil, fmt.Errorf("%s inherits the version from the parent, update the parent instead", path)
+	}
+	current := strings.TrimSpace(string(content[span[0]:span[1]]))
+	if ref := pomPropertyOnly.FindStringSubmatch(current); ref != nil {
+		if span, found = spans["project/properties/"+ref[1]]; !found {
+			return path, nil, fmt.Errorf("%s: property ${%s} is not defined", path, ref[1])
+		}
+		current = strings.TrimSpace(string(content[span[0]:span[1]]))
+	}
+	if strings.Contains(current, "${") {
+		return path, nil, fmt.Errorf("%s: version %s is an expression and can't be updated", path, current)
+	}
+	return path, replaceTrimmed(content, span[0], span[1], version), nil
+}
+
+// Returns offsets of the text content of project/version and project/properties/* elements
+func pomElementSpans(content []byte) (map[string][2]int, error) {
+	spans := map[string][2]int{}
+	starts := map[string]int{}
+	var path []string
+
+	d := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		before := d.InputOffset()
+		token, err := d.Token()
+		if err == io.EOF {
+			return spans, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			starts[strings.Join(path, "/")] = int(d.InputOffset())
+		case xml.EndElement:
+			name := strings.Join(path, "/")
+			if name == "project/version" || len(path) == 3 && path[1] == "properties" {
+				spans[name] = [2]int{starts[name], int(before)}
+			}
+			path = path[:len(path)-1]
+		}
+	}
+}
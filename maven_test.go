@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestPom(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	var tests = []struct {
+		name     string
+		pom      string
+		expected string
+		err      string
+	}{
+		{"project version", `<project><modelVersion>4.0.0</modelVersion><version>1.0.0-SNAPSHOT</version><dependencies><dependency><version>9.9.9</version></dependency></dependencies></project>`, "1.0.0-SNAPSHOT", ""},
+		{"parent version", `<project><parent><groupId>org</groupId><version>2.1.0</version></parent><artifactId>child</artifactId></project>`, "2.1.0", ""},
+		{"revision", `<project><version>${revision}${changelist}</version><properties><revision>1.2.3</revision><changelist>-SNAPSHOT</changelist></properties></project>`, "1.2.3-SNAPSHOT", ""},
+		{"nested properties", `<project><version>${revision}</version><properties><major>3</major><revision>${major}.0.1</revision></properties></project>`, "3.0.1", ""},
+		{"parent reference", `<project><parent><version>4.0.0</version></parent><version>${project.parent.version}</version></project>`, "4.0.0", ""},
+		{"undefined property", `<project><version>${revision}</version></project>`, "", "property ${revision} is not defined"},
+		{"self reference", `<project><version>${project.version}</version></project>`, "", "property ${project.version} references itself"},
+		{"no version", `<project><artifactId>x</artifactId></project>`, "", "neither project nor parent version is declared"},
+		{"invalid xml", `<project><version>`, "", "Failed to parse"},
+	}
+
+	for i, test := range tests {
+		path := filepath.Join(dir, string(rune('a'+i)), "pom.xml")
+		writeFile(t, path, test.pom)
+
+		got, err := resolvePomVersion(filepath.Dir(path))
+		if len(test.err) > 0 {
+			assert.ErrorContains(t, err, test.err, "failed while testing "+test.name)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
+	}
+}
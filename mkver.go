@@ -6,8 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
-	"regexp"
+	"path/filepath"
 	"strings"
 
 	"github.com/urfave/cli"
@@ -17,17 +16,56 @@ import (
 type Config struct {
 	profile           string
 	env, gradle       string
+	npm, npmWorkspace string
+	maven             string
+	source            string
+	sources           []string
+	gitTag            bool
+	gitTagPrefix      string
+	gitTagMode        string
 	gitSha, gitRef    bool
 	gitRefIgnore      []string
 	gitBuildNum       string
 	gitBuildNumBranch []string
+	format            string
+	output            string
+	exports           []string
+	exportFile        string
+	exportPrefix      string
+	writeTo           []string
+	chart             string
+	versionFile       string
+	dryRun            bool
+	dockerPlus        string
+	dockerFloating    bool
+	dockerRelease     []string
+	snapshot          []string
+	snapshotQualifier string
+	timestamp         bool
+	timestampLayout   string
+	clock             string
+	gitDirty          bool
+	gitDirtyMarker    string
+	gitDirtyTimestamp bool
+	verifyNonDirty    bool
+	release           bool
+	verifyRelease     bool
+	ci                string
+	pullRequest       bool
+	detachedBranch    string
+	workflow          string
+	rules             []BranchRule
+	traces            map[string]Trace
 }
 
-var execCommand = exec.Command
+// Opens the git repository of the working directory
+var openGitRepository = func() (*GitRepository, error) {
+	return OpenGitRepository(".")
+}
 
 // DefaultConfigs contain pre-configured short-cuts
 var DefaultConfigs = map[string]Config{
-	"gradle": Config{gitRef: true, gitRefIgnore: []string{"^develop$", "^master$", "^release", "^hotfix"}, gitBuildNum: "b", gitBuildNumBranch: []string{"^release", "^hotfix", "master"}},
+	"gradle": Config{gitRef: true, gitRefIgnore: []string{"^develop$", "^master$", "^release", "^hotfix"}, gitBuildNum: "b", gitBuildNumBranch: []string{"^release", "^hotfix", "master"}, snapshot: []string{"^develop", "^feature/", "^defect/", "^bugfix/"}},
 	"npm":    Config{gitRef: true, gitRefIgnore: []string{"^develop$", "^master$", "^release", "^hotfix"}},
 	"docker": Config{profile: "docker", gitSha: true, gitRef: true, gitRefIgnore: []string{"^develop$", "^master$", "^release", "^hotfix"}, gitBuildNum: "b"},
 	"helm":   Config{gitSha: true, gitRef: true, gitRefIgnore: []string{"^develop$", "^master$", "^release", "^hotfix"}, gitBuildNum: "b"},
@@ -40,33 +78,40 @@ func main() {
 	app.Name = "mkver"
 	app.Usage = "Calculates application version by enriching the original one with various information"
 	app.Version = "0.3.0"
-	app.Commands = nil
-	app.Flags = []cli.Flag{
-		EnvFlag,
-		GradleFlag,
-		GitShaFlag,
-		GitBuildNumFlag,
-		GitBuildNumBranchFlag,
-		GitRefFlag,
-		GitRefIgnoreFlag,
-		SnapshotFlag,
-		ForFlag,
+	app.Commands = []cli.Command{
+		BumpCommand,
 	}
+	app.Flags = Flags
 
 	app.Action = func(ctx *cli.Context) {
-		config := configure(*ctx)
+		config, err := configure(*ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if ctx.Bool(ExplainFlag.Name) {
+			fmt.Fprint(os.Stderr, config.Explain())
+		}
+
+		// Fail early, if the working tree has to be clean
+		if config.verifyNonDirty {
+			if err := verifyNonDirty(); err != nil {
+				cli.HandleExitCoder(err) // exits with ExitDirty
+				log.Fatal(err)
+			}
+		}
 
 		// Resolve the version, that will be used as a ground for further calculations
 		// Version can be resolved from the env variable, gradle.properties or any other supported location
-		version, err := resolveVersion(&config)
+		version, source, err := resolveVersion(&config)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 		// Resolve the git branch
 		branch, err := resolveGitBranch(&config)
-		if err != nil || len(branch) == 0 {
-			branch = "unknown"
+		if err != nil {
+			log.Fatal(err)
 		}
 
 		semanticVersion, err := Calculate(config, version, branch)
@@ -75,11 +120,69 @@ func main() {
 			log.Fatal(err)
 		}
 
-		if len(semanticVersion) == 0 {
+		// Render the final version from the template, if one is provided
+		finalVersion := semanticVersion
+		if len(config.format) > 0 {
+			fields, err := templateFields(config.format)
+			if err != nil {
+				log.Fatal(err)
+			}
+			finalVersion, err = New(collectMetadata(&config, version, branch, semanticVersion, fields)).Execute(config.format)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if len(finalVersion) == 0 {
 			log.Fatal(errors.New("Failed to calculate version"))
 		}
 
-		fmt.Printf("%s", semanticVersion)
+		// Stop the non-release versions from being published as releases, the printed version is verified
+		if config.verifyRelease {
+			if err := verifyRelease(finalVersion); err != nil {
+				cli.HandleExitCoder(err) // exits with ExitNotRelease
+				log.Fatal(err)
+			}
+		}
+
+		// Write the version to the manifests, f.e. before building the release artifacts
+		for _, target := range config.writeTo {
+			if err := writeVersion(&config, target, finalVersion, os.Stderr); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Export the components of the version, the ones exported to stdout replace the version output
+		exportedToStdout := false
+		if len(config.exports) > 0 {
+			report := collectReport(&config, source, version, branch, semanticVersion, finalVersion)
+			for _, format := range config.exports {
+				stdout, err := exportReport(os.Stdout, report, format, config.exportFile, config.exportPrefix)
+				if err != nil {
+					log.Fatal(err)
+				}
+				exportedToStdout = exportedToStdout || stdout
+			}
+		}
+		if exportedToStdout {
+			return
+		}
+
+		// Print either the version alone, its image tags or all of its components
+		switch config.output {
+		case "docker":
+			tags, err := dockerTags(&config, finalVersion, branch)
+			if err != nil {
+				log.Fatal(err)
+			}
+			finalVersion = strings.Join(tags, "\n")
+		case "json", "yaml":
+			finalVersion, err = renderReport(collectReport(&config, source, version, branch, semanticVersion, finalVersion), config.output)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Printf("%s", finalVersion)
 	}
 
 	err := app.Run(os.Args)
@@ -91,206 +194,659 @@ func main() {
 
 // Calculate produces application version by enriching the original one with meta-informaiton based on the provided flags
 func Calculate(config Config, version string, branch string) (string, error) {
-	var versionBuilder strings.Builder
+	semver, err := ParseSemVerLenient(version)
+	if err != nil {
+		return calculatePassThrough(config, version, branch, err)
+	}
 
-	// Splits original version by "-" into 2 parts: root and ext. F.e. 1.0.0-SNAPSHOT => 1.0.0 (root) and SNAPSHOT (ext)
-	versionRoot, versionExt := resolveVersionRootAndExt(version)
+	// Release version is the original one without any qualifiers. F.e. 1.0.0-rc.3+git.1a2b3c => 1.0.0
+	if config.release {
+		return semver.Core(), nil
+	}
+
+	// Detach the original prerelease, so that enrichments go right after MAJOR.MINOR.PATCH.
+	// F.e. 1.0.0-SNAPSHOT => 1.0.0 (core) and SNAPSHOT (prerelease)
+	prerelease := semver.Prerelease
+	semver.Prerelease = nil
 
-	versionBuilder.WriteString(versionRoot)
+	// Resolve which enrichments apply to the branch: from the branch rules or from the flags.
+	strategy := resolveStrategy(&config, branch)
 
 	// Process git-ref. F.e. 1.0.0-SNAPSHOT on feature/x branch => 1.0.0-feature-x-SNAPSHOT
-	processGitRef(&config, branch, &versionBuilder)
+	processGitRef(&strategy, branch, &semver)
+
+	// Process static prerelease label of the branch rule. F.e. 1.0.0 => 1.0.0-beta
+	processPrerelease(&strategy, &semver)
 
 	// Process git-build-num. Will add build number taken from env variable to the result version.
-	// F.e. 1.0.0 on the release/1.0.0 branch => 1.0.0-rcX (where x is a $BUILD_NUMBER env variable)
-	processGitBuildNum(&config, branch, &versionBuilder)
+	// F.e. 1.0.0 on the release/1.0.0 branch => 1.0.0-rcX (where x is the build number reported by CI)
+	processGitBuildNum(&config, &strategy, &semver)
 
 	// Process git-sha. Will add git sha to the result version.
 	// F.e. 1.0.0-SNAPSHOT => 1.0.0-ea3op1-SNAPSHOT
-	processGitSha(&config, branch, &versionBuilder)
+	if err := processGitSha(&config, &strategy, &semver); err != nil {
+		return "", err
+	}
+
+	// Process timestamp. F.e. 1.0.0-SNAPSHOT => 1.0.0-20191017101500-SNAPSHOT
+	if err := processTimestamp(&config, &semver); err != nil {
+		return "", err
+	}
+
+	// Process dirty marker. F.e. 1.0.0-SNAPSHOT => 1.0.0-dirty-SNAPSHOT, 1.0.0 => 1.0.0-dirty.20191017101500
+	if err := processGitDirty(&config, &semver); err != nil {
+		return "", err
+	}
+
+	// Appending back the original prerelease, docker images don't carry it.
+	// Snapshot qualifier is stripped, if snapshot is configured, and is added back on snapshot branches only.
+	// F.e. 1.0.0-SNAPSHOT => 1.0.0-SNAPSHOT (develop), 1.0.0 (release/1.0.0)
+	if config.profile != "docker" {
+		if strategy.Snapshot != nil {
+			prerelease = stripQualifier(prerelease, config.SnapshotQualifier())
+		}
+		semver.AppendQualifier(strings.Join(prerelease, "."))
+	}
+	if strategy.Snapshot != nil && *strategy.Snapshot {
+		semver.AppendQualifier(config.SnapshotQualifier())
+	}
+
+	return semver.String(), nil
+}
 
-	// Appending back the version extension, which has been calculated together with a version root
-	if len(versionExt) > 0 && config.profile == "gradle" {
-		versionBuilder.WriteString("-" + versionExt)
+// Versions, which are not SemVer (f.e. 1.2.3.4 or 2019.10.17.1), are passed through as is:
+// the part before the first "-" or "+" is kept untouched, the enrichments are calculated for the rest.
+// F.e. 1.2.3.4-SNAPSHOT on feature/x with --git-ref => 1.2.3.4-feature-x-SNAPSHOT
+func calculatePassThrough(config Config, version string, branch string, cause error) (string, error) {
+	core, rest := strings.TrimSpace(version), ""
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core, rest = core[:i], core[i:]
+	}
+	if len(core) == 0 || strings.ContainsAny(core, " \t") {
+		return "", cause
+	}
+	if _, err := ParseSemVerLenient("0.0.0" + rest); err != nil {
+		return "", cause
 	}
 
-	return versionBuilder.String(), nil
+	calculated, err := Calculate(config, "0.0.0"+rest, branch)
+	if err != nil {
+		return "", err
+	}
+	return core + strings.TrimPrefix(calculated, "0.0.0"), nil
+}
+
+// Collects the meta-information available to the --format template
+// Only the fields, which are referenced, are resolved, as some of them scan the repository. Nil fields mean all of them.
+func collectMetadata(cfg *Config, origin string, branch string, version string, fields map[string]bool) Metadata {
+	wants := func(names ...string) bool {
+		for _, name := range names {
+			if fields == nil || fields[name] {
+				return true
+			}
+		}
+		return false
+	}
+
+	metadata := Metadata{
+		Origin:    origin,
+		Version:   version,
+		GitBranch: branch,
+		GitRef:    sanitizeRef(branch),
+	}
+
+	if wants("GitSha") {
+		metadata.GitSha, _ = resolveGitSha(cfg) // template fields are empty outside of git repository
+	}
+
+	if wants("BuildNumber") {
+		metadata.BuildNumber = resolveBuildNumber(cfg)
+	}
+
+	if wants("Dirty") {
+		metadata.Dirty = resolveGitDirty()
+	}
+
+	if wants("Timestamp") {
+		if timestamp, err := resolveTimestamp(cfg); err == nil {
+			metadata.Timestamp = formatTimestamp(timestamp, cfg.timestampLayout)
+		}
+	}
+
+	if wants("PrNumber", "PrSourceBranch", "PrTargetBranch") {
+		if info, found := resolveBuildInfo(cfg); found && len(info.PrNumber) > 0 {
+			metadata.PrNumber = info.PrNumber
+			metadata.PrSourceBranch = info.Branch
+			metadata.PrTargetBranch = info.PrTargetBranch
+		}
+	}
+
+	if wants("GitTag", "GitTagDistance", "GitTagExact") {
+		if description, err := describeGitTag(cfg.gitTagPrefix); err == nil {
+			metadata.GitTag = description.Tag
+			metadata.GitTagDistance = description.Distance
+			metadata.GitTagExact = description.Exact()
+		}
+	}
+
+	if semver, err := ParseSemVerLenient(origin); err == nil {
+		metadata.Major = semver.Major
+		metadata.Minor = semver.Minor
+		metadata.Patch = semver.Patch
+		// Release versions carry neither prerelease nor build metadata of the origin
+		if !cfg.release {
+			metadata.Prerelease = strings.Join(semver.Prerelease, ".")
+			metadata.Build = strings.Join(semver.Build, ".")
+		}
+	}
+
+	return metadata
 }
 
 //
 // UTILS
 //
 
-func configure(ctx cli.Context) Config {
-	var config Config
+func configure(ctx cli.Context) (Config, error) {
+	config := Config{gitTagPrefix: GitTagPrefixFlag.Value, exportPrefix: ExportPrefixFlag.Value}
+	var file Settings
 
-	// If "for" flag is present - apply one of the pre-defined configs
-	if ctx.IsSet(ForFlag.Name) {
-		name := ctx.String(ForFlag.Name)
-		config = DefaultConfigs[name]
+	// Read the config file, either the provided one or the closest to the working directory
+	path := ctx.String(ConfigFlag.Name)
+	if len(path) == 0 {
+		if wd, err := os.Getwd(); err == nil {
+			path, _ = findConfigFile(wd)
+		}
+	}
+	if len(path) > 0 {
+		var err error
+		if file, err = readSettingsFile(path); err != nil {
+			return config, err
+		}
+		file.resolvePaths(filepath.Dir(path))
 	}
 
+	// Collect user-defined profiles: user-wide ones, shared ones and the ones from the config file
+	profilePaths := []string{userProfilesDir()}
+	if shared := ctx.String(ProfilesFlag.Name); len(shared) > 0 {
+		profilePaths = append(profilePaths, filepath.SplitList(shared)...)
+	}
+	profiles, err := loadProfiles(profilePaths)
+	if err != nil {
+		return config, err
+	}
+	profiles.add(file.Profiles, path)
+
+	// If "for" flag or setting is present - apply the profile together with the ones it extends
+	if name := file.For; len(name) > 0 || ctx.IsSet(ForFlag.Name) {
+		origin := path
+		if ctx.IsSet(ForFlag.Name) {
+			name, origin = ctx.String(ForFlag.Name), "flags"
+		}
+		layers, builtIn, err := profiles.Resolve(name)
+		if err != nil {
+			return config, err
+		}
+		for _, l := range layers {
+			config.apply(l.settings, l.origin)
+		}
+		config.profile = DefaultConfigs[builtIn].profile
+		config.trace("for", name, origin)
+	}
+
+	// Settings from the config file override the profile
+	config.apply(file, path)
+
+	// Flags override everything else
+	var flags Settings
+	if ctx.IsSet(SourceFlag.Name) {
+		flags.Source = stringOf(ctx.String(SourceFlag.Name))
+	}
 	if ctx.IsSet(EnvFlag.Name) {
-		config.env = ctx.String(EnvFlag.Name)
+		flags.Env = stringOf(ctx.String(EnvFlag.Name))
 	}
 	if ctx.IsSet(GradleFlag.Name) {
-		config.gradle = ctx.String(GradleFlag.Name)
+		flags.Gradle = stringOf(ctx.String(GradleFlag.Name))
+	}
+	if ctx.IsSet(MavenFlag.Name) {
+		flags.Maven = stringOf(ctx.String(MavenFlag.Name))
+	}
+	if ctx.IsSet(GitTagFlag.Name) {
+		flags.GitTag = boolOf(ctx.Bool(GitTagFlag.Name))
+	}
+	if ctx.IsSet(GitTagPrefixFlag.Name) {
+		flags.GitTagPrefix = stringOf(ctx.String(GitTagPrefixFlag.Name))
+	}
+	if ctx.IsSet(GitTagModeFlag.Name) {
+		flags.GitTagMode = stringOf(ctx.String(GitTagModeFlag.Name))
+	}
+	if ctx.IsSet(NpmFlag.Name) {
+		flags.Npm = stringOf(ctx.String(NpmFlag.Name))
+	}
+	if ctx.IsSet(NpmWorkspaceFlag.Name) {
+		flags.NpmWorkspace = stringOf(ctx.String(NpmWorkspaceFlag.Name))
 	}
 	if ctx.IsSet(GitShaFlag.Name) {
-		config.gitSha = ctx.Bool(GitShaFlag.Name)
+		flags.GitSha = boolOf(ctx.Bool(GitShaFlag.Name))
 	}
 	if ctx.IsSet(GitBuildNumFlag.Name) {
-		config.gitBuildNum = ctx.String(GitBuildNumFlag.Name)
+		flags.GitBuildNum = stringOf(ctx.String(GitBuildNumFlag.Name))
 	}
 	if ctx.IsSet(GitBuildNumBranchFlag.Name) {
-		config.gitBuildNumBranch = ctx.StringSlice(GitBuildNumBranchFlag.Name)
+		flags.GitBuildNumBranch = ctx.StringSlice(GitBuildNumBranchFlag.Name)
 	}
 	if ctx.IsSet(GitRefFlag.Name) {
-		config.gitRef = ctx.Bool(GitRefFlag.Name)
+		flags.GitRef = boolOf(ctx.Bool(GitRefFlag.Name))
 	}
 	if ctx.IsSet(GitRefIgnoreFlag.Name) {
-		config.gitRefIgnore = ctx.StringSlice(GitRefIgnoreFlag.Name)
+		flags.GitRefIgnore = ctx.StringSlice(GitRefIgnoreFlag.Name)
+	}
+	if ctx.IsSet(FormatFlag.Name) {
+		flags.Format = stringOf(ctx.String(FormatFlag.Name))
+	}
+	if ctx.IsSet(OutputFlag.Name) {
+		flags.Output = stringOf(ctx.String(OutputFlag.Name))
+	}
+	if ctx.IsSet(ExportFlag.Name) {
+		flags.Exports = ctx.StringSlice(ExportFlag.Name)
+	}
+	if ctx.IsSet(ExportFileFlag.Name) {
+		flags.ExportFile = stringOf(ctx.String(ExportFileFlag.Name))
+	}
+	if ctx.IsSet(ExportPrefixFlag.Name) {
+		flags.ExportPrefix = stringOf(ctx.String(ExportPrefixFlag.Name))
+	}
+	if ctx.IsSet(WriteToFlag.Name) {
+		flags.WriteTo = ctx.StringSlice(WriteToFlag.Name)
+	}
+	if ctx.IsSet(ChartFlag.Name) {
+		flags.Chart = stringOf(ctx.String(ChartFlag.Name))
+	}
+	if ctx.IsSet(VersionFileFlag.Name) {
+		flags.VersionFile = stringOf(ctx.String(VersionFileFlag.Name))
+	}
+	if ctx.IsSet(DryRunFlag.Name) {
+		flags.DryRun = boolOf(ctx.Bool(DryRunFlag.Name))
+	}
+	if ctx.IsSet(DockerPlusFlag.Name) {
+		flags.DockerPlus = stringOf(ctx.String(DockerPlusFlag.Name))
+	}
+	if ctx.IsSet(DockerFloatingTagsFlag.Name) {
+		flags.DockerFloating = boolOf(ctx.Bool(DockerFloatingTagsFlag.Name))
 	}
+	if ctx.IsSet(DockerReleaseBranchFlag.Name) {
+		flags.DockerRelease = ctx.StringSlice(DockerReleaseBranchFlag.Name)
+	}
+	if ctx.IsSet(SnapshotFlag.Name) {
+		flags.Snapshot = ctx.StringSlice(SnapshotFlag.Name)
+	}
+	if ctx.IsSet(SnapshotQualifierFlag.Name) {
+		flags.SnapshotQualifier = stringOf(ctx.String(SnapshotQualifierFlag.Name))
+	}
+	if ctx.IsSet(WorkflowFlag.Name) {
+		flags.Workflow = stringOf(ctx.String(WorkflowFlag.Name))
+	}
+	if ctx.IsSet(TimestampFlag.Name) {
+		flags.Timestamp = boolOf(ctx.Bool(TimestampFlag.Name))
+	}
+	if ctx.IsSet(TimestampLayoutFlag.Name) {
+		flags.TimestampLayout = stringOf(ctx.String(TimestampLayoutFlag.Name))
+	}
+	if ctx.IsSet(ClockFlag.Name) {
+		flags.Clock = stringOf(ctx.String(ClockFlag.Name))
+	}
+	if ctx.IsSet(GitDirtyFlag.Name) {
+		flags.GitDirty = boolOf(ctx.Bool(GitDirtyFlag.Name))
+	}
+	if ctx.IsSet(GitDirtyMarkerFlag.Name) {
+		flags.GitDirtyMarker = stringOf(ctx.String(GitDirtyMarkerFlag.Name))
+	}
+	if ctx.IsSet(GitDirtyTimestampFlag.Name) {
+		flags.GitDirtyTimestamp = boolOf(ctx.Bool(GitDirtyTimestampFlag.Name))
+	}
+	if ctx.IsSet(GitVerifyNonDirtyFlag.Name) {
+		flags.VerifyNonDirty = boolOf(ctx.Bool(GitVerifyNonDirtyFlag.Name))
+	}
+	if ctx.IsSet(ReleaseFlag.Name) {
+		flags.Release = boolOf(ctx.Bool(ReleaseFlag.Name))
+	}
+	if ctx.IsSet(VerifyReleaseFlag.Name) {
+		flags.VerifyRelease = boolOf(ctx.Bool(VerifyReleaseFlag.Name))
+	}
+	if ctx.IsSet(CIFlag.Name) {
+		flags.CI = stringOf(ctx.String(CIFlag.Name))
+	}
+	if ctx.IsSet(PullRequestFlag.Name) {
+		flags.PullRequest = boolOf(ctx.Bool(PullRequestFlag.Name))
+	}
+	if ctx.IsSet(DetachedBranchFlag.Name) {
+		flags.DetachedBranch = stringOf(ctx.String(DetachedBranchFlag.Name))
+	}
+	config.apply(flags, "flags")
 
-	return config
+	if err := validateSources(config.source, config.sources); err != nil {
+		return config, err
+	}
+	if err := validateCI(config.ci); err != nil {
+		return config, err
+	}
+	if err := validateTimestamp(config.clock, config.timestampLayout); err != nil {
+		return config, err
+	}
+	if err := validateOutput(config.output); err != nil {
+		return config, err
+	}
+	if err := validateExports(config.exports); err != nil {
+		return config, err
+	}
+	if err := validateWriteTargets(config.writeTo); err != nil {
+		return config, err
+	}
+	if err := validateDockerPlus(config.dockerPlus); err != nil {
+		return config, err
+	}
+	if err := validateDirtyMarker(config.gitDirtyMarker); err != nil {
+		return config, err
+	}
+	return config, validateRules(config.workflow, config.rules)
 }
 
-// Resolves original version from one of the sources
-func resolveVersion(cfg *Config) (string, error) {
+func stringOf(s string) *string {
+	return &s
+}
 
-	// Resolve from the provided env variable
-	// In case, if "--env=.." flag is specified, resolve env variable with the provided name
-	if len(cfg.env) > 0 {
+func boolOf(b bool) *bool {
+	return &b
+}
 
-		if val, found := os.LookupEnv(cfg.env); found {
-			return val, nil
+func resolveGitBranch(cfg *Config) (string, error) {
+	// Determine the git branch from env if running on CI, otherwise from git
+	// Tag goes first, as some CI set the branch to the tag name on tag builds
+	if info, found := resolveBuildInfo(cfg); found {
+		if len(info.Tag) > 0 {
+			return TagRefPrefix + info.Tag, nil
 		}
+		if len(info.Branch) > 0 {
+			return info.Branch, nil
+		}
+	}
 
-		return "", fmt.Errorf("Failed to resolve version from env variable: $%s", cfg.env)
+	// Not a CI build
+	repo, err := openGitRepository()
+	if err == ErrNotGitRepository {
+		return "unknown", nil // f.e. building from the source archive
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve git branch: %v", err)
+	}
+	defer repo.Close()
+	branch, sha, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve git branch: %v", err)
 	}
+	if len(branch) > 0 {
+		return branch, nil
+	}
+	return resolveDetachedBranch(cfg, repo, sha)
+}
 
-	// Resolve from gradle
-	if len(cfg.gradle) > 0 {
-		if _, err := os.Stat(cfg.gradle); err == nil {
-			gradleProperties, err := readPropertiesFile(cfg.gradle)
-			if err != nil {
-				return "", fmt.Errorf("Failed to resolve version from gradle properties file: $%s", cfg.gradle)
+// TagRefPrefix marks tag builds, which are resolved as refs/tags/<tag> instead of the branch
+const TagRefPrefix = "refs/tags/"
+
+// Resolves the branch, when HEAD is detached (f.e. CI checked out a tag or a commit):
+// the tag pointing to HEAD, the branch containing HEAD closest to its tip, or the configured fallback.
+func resolveDetachedBranch(cfg *Config, repo *GitRepository, sha string) (string, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve git branch of detached HEAD: %v", err)
+	}
+	if names := tags[sha]; len(names) > 0 {
+		// Version tags go first, f.e. v1.0.0 rather than deployed-to-prod
+		for _, name := range names {
+			if _, err := ParseSemVerLenient(strings.TrimPrefix(name, cfg.gitTagPrefix)); err == nil && strings.HasPrefix(name, cfg.gitTagPrefix) {
+				return TagRefPrefix + name, nil
 			}
-			return gradleProperties["version"], nil
 		}
+		return TagRefPrefix + names[0], nil
+	}
 
-		return "", fmt.Errorf("Failed to resolve version from gradle properties file: $%s", cfg.gradle)
+	branch, found, err := repo.NearestBranch(sha)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve git branch of detached HEAD: %v", err)
+	}
+	if found {
+		return branch, nil
 	}
 
-	// Try to auto-detect the original version source
+	if len(cfg.detachedBranch) > 0 {
+		return cfg.detachedBranch, nil
+	}
+	return "", fmt.Errorf("Failed to resolve git branch: HEAD is detached at %s, neither a tag nor a branch points to it, use --%s to set the branch", sha[:7], DetachedBranchFlag.Name)
+}
 
-	// Resolve from the default env variable (VERSION)
-	if val, found := os.LookupEnv("VERSION"); found {
-		return val, nil
+// Resolves which enrichments apply to the build.
+// Pull requests get their own versions, so that they never collide with the builds of the source branch.
+func resolveStrategy(cfg *Config, branch string) Strategy {
+	if info, found := resolveBuildInfo(cfg); found && cfg.pullRequest && len(info.PrNumber) > 0 {
+		return pullRequestStrategy(info)
 	}
+	return cfg.Strategy(branch)
+}
 
-	// Resolve from the default gradle.properties file
-	if _, err := os.Stat("gradle.properties"); err == nil {
-		gradleProperties, err := readPropertiesFile("gradle.properties")
-		if err != nil {
-			return "", fmt.Errorf("Failed to resolve version from gradle.properties")
-		}
-		return gradleProperties["version"], nil
+func resolveBuildNumber(cfg *Config) string {
+	if info, found := resolveBuildInfo(cfg); found && len(info.BuildNumber) > 0 {
+		return info.BuildNumber
+	}
+	return "0"
+}
+
+// Returns the abbreviated sha of HEAD
+var resolveGitSha = func(cfg *Config) (string, error) {
+	if info, found := resolveBuildInfo(cfg); found && len(info.Sha) >= 6 {
+		return info.Sha[:6], nil
 	}
 
-	return "", errors.New("Failed to resolve version")
+	repo, err := openGitRepository()
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve git sha: %v", err)
+	}
+	defer repo.Close()
+	_, sha, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve git sha: %v", err)
+	}
+	if len(sha) == 0 {
+		return "unknown", nil // No commits yet
+	}
+	return sha[:6], nil
 }
 
-func resolveVersionRootAndExt(version string) (string, string) {
-	if strings.Contains(version, "-") {
-		versionParts := strings.Split(version, "-")
-		return strings.TrimSpace(versionParts[0]), strings.TrimSpace(versionParts[1])
+// Lists the changes of the working tree, either staged or not, and untracked files
+var resolveGitChanges = func() ([]GitChange, error) {
+	repo, err := openGitRepository()
+	if err != nil {
+		return nil, err
 	}
+	defer repo.Close()
+	return repo.Status()
+}
 
-	return version, ""
+// Reports whether the working tree has changes, working trees which can't be read are not dirty
+func resolveGitDirty() bool {
+	changes, err := resolveGitChanges()
+	return err == nil && len(changes) > 0
 }
 
-func resolveGitBranch(cfg *Config) (string, error) {
-	// Determine the git branch from env if running on CI, otherwise from git
-	if _, found := os.LookupEnv("BUILD_NUMBER"); found { // magic jenkins variable
-		if _, found := os.LookupEnv("CHANGE_ID"); found { // Are we building a PR?
-			val, _ := os.LookupEnv("CHANGE_BRANCH")
-			return val, nil
-		}
+// ExitDirty is the exit code of --verify-non-dirty, when git is dirty
+const ExitDirty = 3
 
-		val, _ := os.LookupEnv("BRANCH_NAME") // Not a PR
-		return val, nil
+// Fails with the list of changed paths, if git is dirty
+func verifyNonDirty() error {
+	changes, err := resolveGitChanges()
+	if err != nil {
+		return fmt.Errorf("Failed to verify git working tree: %v", err)
+	}
+	if len(changes) == 0 {
+		return nil
 	}
 
-	// Not a CI build
-	//TODO: change to lib?
-	out, err := execCommand("bash", "-c", "git rev-parse --abbrev-ref HEAD 2> /dev/null  || echo 'unknown'").Output()
-	return strings.TrimSpace(string(out[:])), err
+	var b strings.Builder
+	b.WriteString("Git working tree is dirty:")
+	for _, change := range changes {
+		b.WriteString("\n  " + change.String())
+	}
+	return cli.NewExitError(b.String(), ExitDirty)
 }
 
-func processGitRef(cfg *Config, branch string, versionBuilder *strings.Builder) {
+// ExitNotRelease is the exit code of --verify-release, when the version is not a release one
+const ExitNotRelease = 4
 
-	// Check if "--git-ref" flag is specified, otherwise - skip version processing
-	if !cfg.gitRef {
-		return
+// Fails with the reason, if the version has prerelease identifiers or build metadata
+func verifyRelease(version string) error {
+	semver, err := ParseSemVerLenient(version)
+	if err != nil {
+		return cli.NewExitError(fmt.Sprintf("Version %s is not a release: %v", version, err), ExitNotRelease)
 	}
 
-	var ignore bool
-
-	if len(cfg.gitRefIgnore) > 0 {
-		for _, b := range cfg.gitRefIgnore {
-			if match, _ := regexp.MatchString(b, branch); match {
-				ignore = true
-			}
-		}
+	var reasons []string
+	if semver.IsPrerelease() {
+		reasons = append(reasons, fmt.Sprintf("prerelease %q", strings.Join(semver.Prerelease, ".")))
+	}
+	if len(semver.Build) > 0 {
+		reasons = append(reasons, fmt.Sprintf("build metadata %q", strings.Join(semver.Build, ".")))
+	}
+	if len(reasons) == 0 {
+		return nil
 	}
+	return cli.NewExitError(fmt.Sprintf("Version %s is not a release: it has %s", version, strings.Join(reasons, " and ")), ExitNotRelease)
+}
+
+func processGitRef(strategy *Strategy, branch string, semver *SemVer) {
 
-	if !ignore {
-		versionBuilder.WriteString("-" + strings.ToLower(strings.Replace(branch, "/", "-", -1)))
+	// Check if git ref is enabled for the branch, otherwise - skip version processing
+	if !strategy.GitRef {
+		return
 	}
 
+	semver.AppendQualifier(sanitizeRef(branch))
 }
 
-func processGitBuildNum(cfg *Config, branch string, versionBuilder *strings.Builder) {
-	if len(cfg.gitBuildNum) == 0 {
+func processPrerelease(strategy *Strategy, semver *SemVer) {
+	semver.AppendQualifier(strategy.Prerelease)
+}
+
+func processGitBuildNum(cfg *Config, strategy *Strategy, semver *SemVer) {
+	if len(strategy.GitBuildNum) == 0 {
 		return
 	}
 
-	var ignore = false
+	semver.AppendQualifier(strategy.GitBuildNum + resolveBuildNumber(cfg))
+}
 
-	if len(cfg.gitBuildNumBranch) > 0 {
-		ignore = true
-		for _, b := range cfg.gitBuildNumBranch {
-			if match, _ := regexp.MatchString(b, branch); match {
-				ignore = false
-			}
-		}
+func processGitSha(cfg *Config, strategy *Strategy, semver *SemVer) error {
+	if !strategy.GitSha {
+		return nil
 	}
 
-	if !ignore {
-		var buildNumber = "0"
+	sha, err := resolveGitSha(cfg)
+	if err != nil {
+		return err
+	}
+	if "docker" == cfg.profile {
+		semver.Build = append(semver.Build, "git", sha)
+	} else {
+		semver.AppendQualifier(sha)
+	}
+	return nil
+}
+
+func processTimestamp(cfg *Config, semver *SemVer) error {
+	if !cfg.timestamp {
+		return nil
+	}
+
+	timestamp, err := resolveTimestamp(cfg)
+	if err != nil {
+		return err
+	}
+	semver.AppendQualifier(formatTimestamp(timestamp, cfg.timestampLayout))
+	return nil
+}
 
-		if val, found := os.LookupEnv("BUILD_NUMBER"); found {
-			buildNumber = val
+// The timestamp of the dirty marker follows --clock and --timestamp-layout, same as --timestamp
+func processGitDirty(cfg *Config, semver *SemVer) error {
+	if !cfg.gitDirty && !cfg.gitDirtyTimestamp || !resolveGitDirty() {
+		return nil
+	}
+
+	marker := valueOr(cfg.gitDirtyMarker, GitDirtyMarkerFlag.Value)
+	if cfg.gitDirtyTimestamp {
+		timestamp, err := resolveTimestamp(cfg)
+		if err != nil {
+			return err
 		}
+		marker += "." + formatTimestamp(timestamp, cfg.timestampLayout)
+	}
+	semver.AppendQualifier(marker)
+	return nil
+}
 
-		versionBuilder.WriteString("-" + cfg.gitBuildNum + buildNumber)
+func validateDirtyMarker(marker string) error {
+	if len(marker) == 0 {
+		return nil
+	}
+	if err := validateIdentifier(marker, true); err != nil {
+		return fmt.Errorf("Invalid dirty marker %q: %v", marker, err)
 	}
+	return nil
+}
 
+// SnapshotQualifier returns the qualifier marking snapshot versions, "SNAPSHOT" by default
+func (c *Config) SnapshotQualifier() string {
+	if len(c.snapshotQualifier) == 0 {
+		return SnapshotQualifierFlag.Value
+	}
+	return c.snapshotQualifier
 }
 
-func processGitSha(cfg *Config, branch string, versionBuilder *strings.Builder) {
-	if !cfg.gitSha {
-		return
+// Removes the qualifier from the end of the prerelease, ignoring case
+// F.e. [rc 1-SNAPSHOT] => [rc 1], [SNAPSHOT] => []
+func stripQualifier(prerelease []string, qualifier string) []string {
+	s := strings.Join(prerelease, ".")
+	switch {
+	case strings.EqualFold(s, qualifier):
+		return nil
+	case len(s) > len(qualifier) && strings.EqualFold(s[len(s)-len(qualifier):], qualifier):
+		if sep := s[len(s)-len(qualifier)-1]; sep == '-' || sep == '.' {
+			return strings.Split(s[:len(s)-len(qualifier)-1], ".")
+		}
 	}
+	return prerelease
+}
 
-	out, _ := execCommand("bash", "-c", "git rev-parse --short=6 HEAD 2> /dev/null  || echo 'unknown'").Output()
-	sha := strings.TrimSpace(string(out[:]))
-	if "docker" == cfg.profile {
-		versionBuilder.WriteString("+git." + sha)
-	} else {
-		versionBuilder.WriteString("-" + sha)
+// Turns git ref into a valid prerelease qualifier. F.e. feature/TEST_123 => feature-test-123
+// Empty identifiers are dropped and numeric ones lose leading zeros. F.e. feature/x..y => feature-x.y, release/1.02 => release-1.2
+func sanitizeRef(ref string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r == '-' || r == '.' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(strings.TrimPrefix(ref, TagRefPrefix)))
+
+	var identifiers []string
+	for _, id := range strings.Split(sanitized, ".") {
+		if isNumeric(id) {
+			id = strings.TrimLeft(id, "0")
+			if len(id) == 0 {
+				id = "0"
+			}
+		}
+		if len(id) > 0 {
+			identifiers = append(identifiers, id)
+		}
 	}
+	return strings.Join(identifiers, ".")
 }
 
 func readPropertiesFile(filename string) (map[string]string, error) {
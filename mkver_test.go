@@ -1,31 +1,24 @@
 package main
 
 import (
-	"fmt"
 	"os"
-	"os/exec"
+	"regexp"
 	"testing"
 
+	"github.com/urfave/cli"
 	"gotest.tools/assert"
 )
 
-// Mock exec.command
-func fakeExecCommand(command string, args ...string) *exec.Cmd {
-	cs := []string{"-test.run=TestHelperProcess", "--", command}
-	cs = append(cs, args...)
-	cmd := exec.Command(os.Args[0], cs...)
-	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
-	return cmd
+// Mock sha of HEAD
+func fakeGitSha(cfg *Config) (string, error) {
+	return "1a2b3c", nil
 }
 
-func TestHelperProcess(t *testing.T) {
-	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
-		return
-	}
-	// some code here to check arguments perhaps?
-	fmt.Fprintf(os.Stdout, "1a2b3c")
-	os.Exit(0)
-}
+var defaultGitSha = resolveGitSha
+
+var defaultOpenGitRepository = openGitRepository
+
+var defaultGitChanges = resolveGitChanges
 
 var tests = []struct {
 	name     string
@@ -37,6 +30,10 @@ var tests = []struct {
 }{
 	{"default", Config{}, "develop", "1.0.0-SNAPSHOT", "1.0.0-SNAPSHOT", nil},
 	{"default", Config{}, "master", "1.0.0", "1.0.0", nil},
+	{"default", Config{}, "master", "v1.0", "1.0.0", nil},
+	{"default", Config{}, "develop", "1.0.0-rc.1-SNAPSHOT", "1.0.0-rc.1-SNAPSHOT", nil},
+	{"default: not semver", Config{}, "master", "1.2.3.4", "1.2.3.4", nil},
+	{"default: not semver", Config{gitRef: true, gitSha: true}, "feature/x", "1.2.3.4-SNAPSHOT", "1.2.3.4-feature-x-1a2b3c-SNAPSHOT", nil},
 
 	// --git-sha
 	{"--git-sha", Config{gitSha: true}, "develop", "1.0.0-SNAPSHOT", "1.0.0-1a2b3c-SNAPSHOT", nil},
@@ -48,6 +45,12 @@ var tests = []struct {
 	{"--git-ref", Config{gitRef: true}, "defect/X", "1.0.0-SNAPSHOT", "1.0.0-defect-x-SNAPSHOT", nil},
 	{"--git-ref", Config{gitRef: true}, "defect/X", "1.0.0", "1.0.0-defect-x", nil},
 	{"--git-ref", Config{gitRef: true}, "feature/TEST-123", "1.0.0", "1.0.0-feature-test-123", nil},
+	{"--git-ref", Config{gitRef: true}, "feature/TEST_123", "1.0.0", "1.0.0-feature-test-123", nil},
+	{"--git-ref", Config{gitRef: true}, "feature/x..y.", "1.0.0", "1.0.0-feature-x.y", nil},
+	{"--git-ref", Config{gitRef: true}, "release/1.02", "1.0.0", "1.0.0-release-1.2", nil},
+	{"--git-ref", Config{gitRef: true}, "release/1.00", "1.0.0", "1.0.0-release-1.0", nil},
+	{"--git-ref", Config{gitRef: true}, "develop", "1.0.0-rc.1-SNAPSHOT", "1.0.0-develop-rc.1-SNAPSHOT", nil},
+	{"--git-ref", Config{gitRef: true}, "develop", "1.0.0-rc.1+build.5", "1.0.0-develop-rc.1+build.5", nil},
 
 	// --git-ref-ignore tests
 	{"--git-ref-ignore", Config{gitRef: true, gitRefIgnore: []string{"^develop$"}}, "develop", "1.0.0", "1.0.0", nil},
@@ -63,39 +66,54 @@ var tests = []struct {
 	{"--git-build-num-branch", Config{gitBuildNum: "rc.", gitBuildNumBranch: []string{"^release", "^hotfix"}}, "release/1.0.0", "1.0.0-SNAPSHOT", "1.0.0-rc.13-SNAPSHOT", nil},
 	{"--git-build-num-branch", Config{gitBuildNum: "rc.", gitBuildNumBranch: []string{"^release", "^hotfix"}}, "develop", "1.0.0-SNAPSHOT", "1.0.0-SNAPSHOT", nil},
 
+	// --snapshot tests
+	{"--snapshot", Config{snapshot: []string{"^develop$"}}, "develop", "1.0.0", "1.0.0-SNAPSHOT", nil},
+	{"--snapshot", Config{snapshot: []string{"^develop$"}}, "develop", "1.0.0-SNAPSHOT", "1.0.0-SNAPSHOT", nil},
+	{"--snapshot", Config{snapshot: []string{"^develop$"}}, "release/1.0.0", "1.0.0-SNAPSHOT", "1.0.0", nil},
+	{"--snapshot", Config{snapshot: []string{"^develop$"}}, "release/1.0.0", "1.0.0-rc.1-snapshot", "1.0.0-rc.1", nil},
+	{"--snapshot", Config{snapshot: []string{"^develop$"}, gitRef: true, gitSha: true}, "develop", "1.0.0-rc.1-SNAPSHOT", "1.0.0-develop-1a2b3c-rc.1-SNAPSHOT", nil},
+	{"--snapshot-qualifier", Config{snapshot: []string{"^feature/"}, snapshotQualifier: "dev", gitRef: true}, "feature/x", "1.0.0", "1.0.0-feature-x-dev", nil},
+	{"--snapshot-qualifier", Config{snapshot: []string{"^feature/"}, snapshotQualifier: "dev"}, "master", "1.0.0-dev", "1.0.0", nil},
+	{"--snapshot rule", Config{snapshot: []string{"^develop$"}, rules: []BranchRule{{Branch: "^develop$", Snapshot: boolOf(false)}}}, "develop", "1.0.0-SNAPSHOT", "1.0.0", nil},
+
 	//
 	// Profiles
 	//
 
 	// --for=gradle
 	// It's important to support SNAPSHOT versioning for Java artifacts
-	// {"--for=gradle", DefaultConfigs["gradle"], "develop", "1.0.0-SNAPSHOT", "1.0.0-SNAPSHOT", nil},
-	// {"--for=gradle", DefaultConfigs["gradle"], "develop-x", "1.0.0-SNAPSHOT", "1.0.0-develop-x-SNAPSHOT", nil},
-	// {"--for=gradle", DefaultConfigs["gradle"], "feature/x", "1.0.0-SNAPSHOT", "1.0.0-feature-x-SNAPSHOT", nil},
-	// {"--for=gradle", DefaultConfigs["gradle"], "defect/XYZ-123", "1.0.0-SNAPSHOT", "1.0.0-defect-xyz-123-SNAPSHOT", nil},
-	// {"--for=gradle", DefaultConfigs["gradle"], "defect/XYZ-123", "1.0.0", "1.0.0-defect-xyz-123-SNAPSHOT", nil}, // FAIL: Should probably be a snapshot?
-	// {"--for=gradle", DefaultConfigs["gradle"], "release/1.0.0", "1.0.0", "1.0.0-b13", nil},
-	// {"--for=gradle", DefaultConfigs["gradle"], "hotfix/1.1.0", "1.1.0", "1.1.0-b13", nil},
-	// {"--for=gradle", DefaultConfigs["gradle"], "master", "1.0.0", "1.0.0-b13", nil},
+	{"--for=gradle", DefaultConfigs["gradle"], "develop", "1.0.0-SNAPSHOT", "1.0.0-SNAPSHOT", nil},
+	{"--for=gradle", DefaultConfigs["gradle"], "develop-x", "1.0.0-SNAPSHOT", "1.0.0-develop-x-SNAPSHOT", nil},
+	{"--for=gradle", DefaultConfigs["gradle"], "feature/x", "1.0.0-SNAPSHOT", "1.0.0-feature-x-SNAPSHOT", nil},
+	{"--for=gradle", DefaultConfigs["gradle"], "defect/XYZ-123", "1.0.0-SNAPSHOT", "1.0.0-defect-xyz-123-SNAPSHOT", nil},
+	{"--for=gradle", DefaultConfigs["gradle"], "defect/XYZ-123", "1.0.0", "1.0.0-defect-xyz-123-SNAPSHOT", nil},
+	{"--for=gradle", DefaultConfigs["gradle"], "release/1.0.0", "1.0.0", "1.0.0-b13", nil},
+	{"--for=gradle", DefaultConfigs["gradle"], "hotfix/1.1.0", "1.1.0", "1.1.0-b13", nil},
+	{"--for=gradle", DefaultConfigs["gradle"], "master", "1.0.0", "1.0.0-b13", nil},
 
 	// --for=npm
-	// {"--for=npm", DefaultConfigs["npm"], "develop", "1.0.0", "1.0.0", nil},
-	// {"--for=npm", DefaultConfigs["npm"], "develop-x", "1.0.0", "1.0.0-develop-x", nil},
-	// {"--for=npm", DefaultConfigs["npm"], "feature/x", "1.0.0", "1.0.0-feature-x", nil},
-	// {"--for=npm", DefaultConfigs["npm"], "defect/XYZ-123", "1.0.0", "1.0.0-defect-xyz-123", nil},
-	// {"--for=npm", DefaultConfigs["npm"], "release/1.0.0", "1.0.0", "1.0.0", nil},
-	// {"--for=npm", DefaultConfigs["npm"], "hotfix/1.1.0", "1.1.0", "1.1.0", nil},
-	// {"--for=npm", DefaultConfigs["npm"], "master", "1.0.0", "1.0.0", nil},
+	{"--for=npm", DefaultConfigs["npm"], "develop", "1.0.0", "1.0.0", nil},
+	{"--for=npm", DefaultConfigs["npm"], "develop-x", "1.0.0", "1.0.0-develop-x", nil},
+	{"--for=npm", DefaultConfigs["npm"], "feature/x", "1.0.0", "1.0.0-feature-x", nil},
+	{"--for=npm", DefaultConfigs["npm"], "defect/XYZ-123", "1.0.0", "1.0.0-defect-xyz-123", nil},
+	{"--for=npm", DefaultConfigs["npm"], "release/1.0.0", "1.0.0", "1.0.0", nil},
+	{"--for=npm", DefaultConfigs["npm"], "hotfix/1.1.0", "1.1.0", "1.1.0", nil},
+	{"--for=npm", DefaultConfigs["npm"], "master", "1.0.0", "1.0.0", nil},
 
 	// --for=docker tests
 	{"--for=docker", DefaultConfigs["docker"], "develop", "1.0.0", "1.0.0-b13+git.1a2b3c", nil},
 	{"--for=docker", DefaultConfigs["docker"], "develop", "1.0.0-SNAPSHOT", "1.0.0-b13+git.1a2b3c", nil}, // Should ignore snapshot suffix
 	{"--for=docker", DefaultConfigs["docker"], "develop-x", "1.0.0", "1.0.0-develop-x-b13+git.1a2b3c", nil},
 	{"--for=docker", DefaultConfigs["docker"], "feature/x", "1.0.0-SNAPSHOT", "1.0.0-feature-x-b13+git.1a2b3c", nil},
-	{"--for=docker", DefaultConfigs["docker"], "defect/XYZ-123", "1.0.0-SNAPSHOT", "1.0.0-defect-xyz-123-1a2b3c-SNAPSHOT", nil},
-	{"--for=docker", DefaultConfigs["docker"], "release/1.0.0", "1.0.0", "1.0.0-rc.13-1a2b3c", nil},
-	{"--for=docker", DefaultConfigs["docker"], "hotfix/1.1.0", "1.1.0", "1.1.0-rc.13-1a2b3c", nil},
-	{"--for=docker", DefaultConfigs["docker"], "master", "1.0.0", "1.0.0-1a2b3c", nil},
+	{"--for=docker", DefaultConfigs["docker"], "defect/XYZ-123", "1.0.0-SNAPSHOT", "1.0.0-defect-xyz-123-b13+git.1a2b3c", nil},
+	{"--for=docker", DefaultConfigs["docker"], "release/1.0.0", "1.0.0", "1.0.0-b13+git.1a2b3c", nil},
+	{"--for=docker", DefaultConfigs["docker"], "hotfix/1.1.0", "1.1.0", "1.1.0-b13+git.1a2b3c", nil},
+	{"--for=docker", DefaultConfigs["docker"], "master", "1.0.0", "1.0.0-b13+git.1a2b3c", nil},
+
+	// --release tests
+	{"--release", Config{release: true}, "develop", "1.0.0-SNAPSHOT", "1.0.0", nil},
+	{"--release", Config{release: true, gitRef: true, gitSha: true, gitBuildNum: "rc."}, "feature/x", "1.0.0-rc.3+git.abc", "1.0.0", nil},
+	{"--release", Config{release: true, profile: "docker", gitSha: true, gitBuildNum: "b"}, "master", "1.0.0", "1.0.0", nil},
 
 	// --for=helm tests
 	// {"--for=helm", DefaultConfigs["docker"], "develop", "1.0.0-SNAPSHOT", "1.0.0-1a2b3c-SNAPSHOT", nil},
@@ -109,9 +127,9 @@ var tests = []struct {
 
 func TestMkver(t *testing.T) {
 	// prepare
-	execCommand = fakeExecCommand
-	defer func() { execCommand = exec.Command }()
-	os.Setenv("BUILD_NUMBER", "13")
+	resolveGitSha = fakeGitSha
+	defer func() { resolveGitSha = defaultGitSha }()
+	defer setCIEnv(map[string]string{"BUILD_NUMBER": "13"})()
 
 	// execute
 	for _, test := range tests {
@@ -119,3 +137,177 @@ func TestMkver(t *testing.T) {
 		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
 	}
 }
+
+func TestCalculatePassThrough(t *testing.T) {
+	got, err := Calculate(Config{release: true}, "2019.10.17.1-rc.1", "master")
+	assert.NilError(t, err)
+	assert.Equal(t, "2019.10.17.1", got)
+
+	_, err = Calculate(Config{}, "", "master")
+	assert.ErrorContains(t, err, "empty version")
+	_, err = Calculate(Config{}, "1.2.3.4-rc_1", "master")
+	assert.ErrorContains(t, err, "1.2.3.4-rc_1")
+}
+
+func TestResolveGitBranch(t *testing.T) {
+	dir, git, cleanup := gitFixture(t)
+	defer cleanup()
+
+	defer setCIEnv(map[string]string{})()
+	openGitRepository = func() (*GitRepository, error) { return OpenGitRepository(dir) }
+	defer func() { openGitRepository = defaultOpenGitRepository }()
+
+	git("commit", "-q", "--allow-empty", "-m", "1")
+	git("tag", "deployed")
+	git("tag", "v1.0.0")
+	git("commit", "-q", "--allow-empty", "-m", "2")
+	git("checkout", "-q", "-b", "feature/x")
+	git("commit", "-q", "--allow-empty", "-m", "f1")
+	git("commit", "-q", "--allow-empty", "-m", "f2")
+	git("checkout", "-q", "--orphan", "orphan")
+	git("commit", "-q", "--allow-empty", "-m", "orphan")
+	git("checkout", "-q", "main")
+	orphan := git("rev-parse", "orphan")
+	git("branch", "-q", "-D", "orphan")
+
+	var tests = []struct {
+		name     string
+		checkout string
+		config   Config
+		expected string
+		err      string
+	}{
+		{"branch", "main", Config{}, "main", ""},
+		{"detached at version tag", "v1.0.0", Config{gitTagPrefix: "v"}, "refs/tags/v1.0.0", ""},
+		{"detached at commit", "feature/x~1", Config{}, "feature/x", ""},
+		{"detached at unreachable commit", orphan, Config{}, "", "Failed to resolve git branch: HEAD is detached at " + orphan[:7] + ", neither a tag nor a branch points to it, use --detached-branch to set the branch"},
+		{"fallback", orphan, Config{detachedBranch: "develop"}, "develop", ""},
+	}
+
+	for _, test := range tests {
+		git("checkout", "-q", "--detach", test.checkout)
+		if test.checkout == "main" {
+			git("checkout", "-q", "main")
+		}
+
+		got, err := resolveGitBranch(&test.config)
+		if len(test.err) > 0 {
+			assert.Error(t, err, test.err, "failed while testing "+test.name)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
+	}
+}
+
+func TestGitDirty(t *testing.T) {
+	defer setCIEnv(map[string]string{"BUILD_NUMBER": "13"})()
+	resolveGitSha = fakeGitSha
+	defer func() { resolveGitSha = defaultGitSha }()
+	defer func() { resolveGitChanges = defaultGitChanges }()
+
+	dirty := func() ([]GitChange, error) {
+		return []GitChange{{" M", "build.gradle"}, {"??", "notes.txt"}}, nil
+	}
+	clean := func() ([]GitChange, error) {
+		return nil, nil
+	}
+
+	var tests = []struct {
+		name     string
+		changes  func() ([]GitChange, error)
+		config   Config
+		branch   string
+		version  string
+		expected string
+	}{
+		{"dirty", dirty, Config{gitDirty: true}, "feature/x", "1.0.0", "^1\\.0\\.0-dirty$"},
+		{"dirty: custom marker", dirty, Config{gitDirty: true, gitDirtyMarker: "local"}, "feature/x", "1.0.0", "^1\\.0\\.0-local$"},
+		{"dirty: snapshot", dirty, Config{gitDirty: true, gitRef: true, gitSha: true}, "feature/x", "1.0.0-SNAPSHOT", "^1\\.0\\.0-feature-x-1a2b3c-dirty-SNAPSHOT$"},
+		{"dirty: timestamp", dirty, Config{gitDirtyTimestamp: true}, "feature/x", "1.0.0", "^1\\.0\\.0-dirty\\.\\d{14}$"},
+		{"dirty: timestamp layout", dirty, Config{gitDirty: true, gitDirtyTimestamp: true, timestampLayout: "iso-basic"}, "feature/x", "1.0.0", "^1\\.0\\.0-dirty\\.\\d{8}T\\d{6}Z$"},
+		{"dirty: tag", dirty, Config{gitDirty: true, gitRef: true}, "refs/tags/v1.0.0", "1.0.0", "^1\\.0\\.0-dirty$"},
+		{"dirty: disabled", dirty, Config{}, "feature/x", "1.0.0", "^1\\.0\\.0$"},
+		{"clean", clean, Config{gitDirty: true, gitDirtyTimestamp: true}, "feature/x", "1.0.0", "^1\\.0\\.0$"},
+	}
+
+	for _, test := range tests {
+		resolveGitChanges = test.changes
+		got, err := Calculate(test.config, test.version, test.branch)
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Assert(t, regexp.MustCompile(test.expected).MatchString(got), "failed while testing %s: %s", test.name, got)
+	}
+
+	resolveGitChanges = clean
+	assert.NilError(t, verifyNonDirty())
+
+	resolveGitChanges = dirty
+	err := verifyNonDirty()
+	assert.Error(t, err, "Git working tree is dirty:\n   M build.gradle\n  ?? notes.txt")
+	assert.Equal(t, ExitDirty, err.(cli.ExitCoder).ExitCode())
+}
+
+// Parses the command line the same way main does
+func configureArgs(t *testing.T, args ...string) (Config, error) {
+	var config Config
+	var err error
+	app := cli.NewApp()
+	app.Flags = Flags
+	app.Action = func(ctx *cli.Context) error {
+		config, err = configure(*ctx)
+		return nil
+	}
+	assert.NilError(t, app.Run(append([]string{"mkver"}, args...)))
+	return config, err
+}
+
+func TestDirtyFlags(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	assert.NilError(t, os.Chdir(dir))
+
+	// The flag right after --dirty is never taken as the marker
+	config, err := configureArgs(t, "--dirty", "--git-ref")
+	assert.NilError(t, err)
+	assert.Assert(t, config.gitDirty)
+	assert.Assert(t, config.gitRef)
+	assert.Equal(t, "", config.gitDirtyMarker)
+
+	config, err = configureArgs(t, "--dirty-marker", "local", "--dirty-timestamp")
+	assert.NilError(t, err)
+	assert.Equal(t, "local", config.gitDirtyMarker)
+	assert.Assert(t, config.gitDirtyTimestamp)
+
+	_, err = configureArgs(t, "--dirty", "--dirty-marker", "01")
+	assert.Error(t, err, "Invalid dirty marker \"01\": numeric identifier \"01\" has a leading zero")
+
+	_, err = configureArgs(t, "--dirty", "--dirty-marker", "dirty.local")
+	assert.ErrorContains(t, err, "Invalid dirty marker \"dirty.local\"")
+}
+
+func TestVerifyRelease(t *testing.T) {
+	var tests = []struct {
+		version string
+		err     string
+	}{
+		{"1.0.0", ""},
+		{"v1.0", ""},
+		{"1.0.0-SNAPSHOT", "Version 1.0.0-SNAPSHOT is not a release: it has prerelease \"SNAPSHOT\""},
+		{"1.0.0-rc.3+git.abc", "Version 1.0.0-rc.3+git.abc is not a release: it has prerelease \"rc.3\" and build metadata \"git.abc\""},
+		{"1.0.0+git.abc", "Version 1.0.0+git.abc is not a release: it has build metadata \"git.abc\""},
+		{"latest", "Version latest is not a release: Invalid semantic version \"latest\": \"latest\" is not a number"},
+	}
+
+	for _, test := range tests {
+		err := verifyRelease(test.version)
+		if len(test.err) == 0 {
+			assert.NilError(t, err, "failed while testing "+test.version)
+			continue
+		}
+		assert.Error(t, err, test.err, "failed while testing "+test.version)
+		assert.Equal(t, ExitNotRelease, err.(cli.ExitCoder).ExitCode(), "failed while testing "+test.version)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PackageJSON contains the fields of package.json used for version resolution
+type PackageJSON struct {
+	Name       string          `json:"name"`
+	Version    string          `json:"version"`
+	Workspaces json.RawMessage `json:"workspaces"`
+}
+
+// Reads package.json, the path can point either to the file or to the directory containing it
+func readPackageJSON(path string) (PackageJSON, string, error) {
+	var pkg PackageJSON
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "package.json")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return pkg, path, err
+	}
+	if err := json.Unmarshal(content, &pkg); err != nil {
+		return pkg, path, fmt.Errorf("Failed to parse %s: %v", path, err)
+	}
+	return pkg, path, nil
+}
+
+// Returns workspace patterns, which are declared either as an array (npm, yarn) or as an object with packages (yarn)
+func (pkg PackageJSON) workspacePatterns() []string {
+	var patterns []string
+	if err := json.Unmarshal(pkg.Workspaces, &patterns); err == nil {
+		return patterns
+	}
+
+	var workspaces struct {
+		Packages []string `json:"packages"`
+	}
+	if err := json.Unmarshal(pkg.Workspaces, &workspaces); err == nil {
+		return workspaces.Packages
+	}
+	return nil
+}
+
+// Finds workspace members of the root package, mapping both their names and directories to package.json paths
+func workspaceMembers(root PackageJSON, rootPath string) map[string]string {
+	members := map[string]string{}
+	dir := filepath.Dir(rootPath)
+
+	for _, pattern := range root.workspacePatterns() {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern, "package.json"))
+		for _, match := range matches {
+			pkg, _, err := readPackageJSON(match)
+			if err != nil {
+				continue
+			}
+			if rel, err := filepath.Rel(dir, filepath.Dir(match)); err == nil {
+				members[filepath.ToSlash(rel)] = match
+			}
+			if len(pkg.Name) > 0 {
+				members[pkg.Name] = match
+			}
+		}
+	}
+	return members
+}
+
+// Resolves version from package.json. In case of the workspace, the version is taken from the member package,
+// which is specified either by the name or by the directory relative to the root package.
+func resolvePackageJSONVersion(path string, workspace string) (string, error) {
+	pkg, path, err := readPackageJSON(path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve version from %s: %v", path, err)
+	}
+
+	if len(workspace) > 0 {
+		members := workspaceMembers(pkg, path)
+		member, found := members[workspace]
+		if !found {
+			return "", fmt.Errorf("Failed to resolve version from %s: workspace %q not found, available workspaces: %s", path, workspace, strings.Join(memberNames(members), ", "))
+		}
+		return resolvePackageJSONVersion(member, "")
+	}
+
+	if len(pkg.Version) == 0 {
+		if members := workspaceMembers(pkg, path); len(members) > 0 {
+			return "", fmt.Errorf("Failed to resolve version from %s: workspace root has no version, specify one of the workspaces: %s", path, strings.Join(memberNames(members), ", "))
+		}
+		return "", fmt.Errorf("Failed to resolve version from %s: no version", path)
+	}
+
+	return pkg.Version, nil
+}
+
+func memberNames(members map[string]string) []string {
+	var names []string
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Replaces the version of package.json, only the top-level "version" is changed and the rest of the file is kept intact
+func rewritePackageJSONVersion(path string, version string) (string, []byte, error) {
+	_, path, err := readPackageJSON(path)
+	if err != nil {
+		return path, nil, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return path, nil, err
+	}
+
+	start, end, found := topLevelJSONString(content, "version")
+	if !found {
+		return path, nil, fmt.Errorf("%s has no version", path)
+	}
+	return path, replaceTrimmed(content, start, end, `"`+version+`"`), nil
+}
+
+// Finds the string value of the key in the top-level JSON object, returning its offsets including the quotes
+func topLevelJSONString(content []byte, key string) (int, int, bool) {
+	depth, isKey := 0, false
+	for i := 0; i < len(content); i++ {
+		switch c := content[i]; c {
+		case '{', '[':
+			depth++
+			isKey = c == '{' && depth == 1
+		case '}', ']':
+			depth--
+		case ',':
+			isKey = depth == 1
+		case '"':
+			end := jsonStringEnd(content, i)
+			if end < 0 {
+				return 0, 0, false
+			}
+			if isKey && string(content[i+1:end]) == key {
+				j := skipJSONSpace(content, end+1)
+				if j < len(content) && content[j] == ':' {
+					j = skipJSONSpace(content, j+1)
+					if j < len(content) && content[j] == '"' {
+						if valueEnd := jsonStringEnd(content, j); valueEnd > 0 {
+							return j, valueEnd + 1, true
+						}
+					}
+				}
+			}
+			isKey = false
+			i = end
+		}
+	}
+	return 0, 0, false
+}
+
+// Returns the offset of the closing quote of the string starting at the offset
+func jsonStringEnd(content []byte, start int) int {
+	for i := start + 1; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func skipJSONSpace(content []byte, i int) int {
+	for i < len(content) && strings.ContainsRune(" \t\r\n", rune(content[i])) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestPackageJSON(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(dir, "app", "package.json"), `{"name": "app", "version": "1.2.3"}`)
+	writeFile(t, filepath.Join(dir, "mono", "package.json"), `{"name": "root", "private": true, "workspaces": ["packages/*"]}`)
+	writeFile(t, filepath.Join(dir, "mono", "packages", "api", "package.json"), `{"name": "@org/api", "version": "2.0.0-SNAPSHOT"}`)
+	writeFile(t, filepath.Join(dir, "mono", "packages", "web", "package.json"), `{"name": "@org/web", "version": "3.1.0"}`)
+	writeFile(t, filepath.Join(dir, "yarn", "package.json"), `{"name": "root", "workspaces": {"packages": ["libs/*"]}}`)
+	writeFile(t, filepath.Join(dir, "yarn", "libs", "core", "package.json"), `{"name": "core", "version": "0.1.0"}`)
+	writeFile(t, filepath.Join(dir, "empty", "package.json"), `{"name": "empty"}`)
+
+	var tests = []struct {
+		name      string
+		path      string
+		workspace string
+		expected  string
+		err       string
+	}{
+		{"file", filepath.Join(dir, "app", "package.json"), "", "1.2.3", ""},
+		{"directory", filepath.Join(dir, "app"), "", "1.2.3", ""},
+		{"workspace by name", filepath.Join(dir, "mono"), "@org/api", "2.0.0-SNAPSHOT", ""},
+		{"workspace by directory", filepath.Join(dir, "mono"), "packages/web", "3.1.0", ""},
+		{"workspace member directly", filepath.Join(dir, "mono", "packages", "web"), "", "3.1.0", ""},
+		{"yarn workspaces", filepath.Join(dir, "yarn"), "core", "0.1.0", ""},
+		{"workspace root", filepath.Join(dir, "mono"), "", "", "workspace root has no version, specify one of the workspaces: @org/api, @org/web, packages/api, packages/web"},
+		{"unknown workspace", filepath.Join(dir, "mono"), "x", "", "workspace \"x\" not found"},
+		{"no version", filepath.Join(dir, "empty"), "", "", "no version"},
+		{"missing", filepath.Join(dir, "missing"), "", "", "Failed to resolve version"},
+	}
+
+	for _, test := range tests {
+		got, err := resolvePackageJSONVersion(test.path, test.workspace)
+		if len(test.err) > 0 {
+			assert.ErrorContains(t, err, test.err, "failed while testing "+test.name)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
+	}
+}
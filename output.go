@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Outputs are the formats the result can be printed in, "text" prints the version only, "docker" prints image tags
+var Outputs = []string{"text", "json", "yaml", "docker"}
+
+// Report contains every component of the version, so that scripts can pick the ones they need.
+// Major, Minor, Patch, Prerelease and Build are the components of the original version, the same ones
+// the templates get, so that the version produced by --format can be rebuilt from the report.
+type Report struct {
+	Version string `json:"version" yaml:"version"` // Final version, rendered from the template if one is provided
+	Origin  string `json:"origin" yaml:"origin"`   // Original version, f.e. 1.0.0-SNAPSHOT
+
+	// Components of the original version, prerelease and build are empty for --release
+	Major      uint64 `json:"major" yaml:"major"`
+	Minor      uint64 `json:"minor" yaml:"minor"`
+	Patch      uint64 `json:"patch" yaml:"patch"`
+	Prerelease string `json:"prerelease" yaml:"prerelease"`
+	Build      string `json:"build" yaml:"build"`
+
+	Source  string `json:"source" yaml:"source"`   // Version source used, f.e. gradle
+	Profile string `json:"profile" yaml:"profile"` // Profile applied with "for", f.e. docker
+	Rule    string `json:"rule" yaml:"rule"`       // Branch rule applied, f.e. ^release/ or pull-request
+
+	Branch         string `json:"branch" yaml:"branch"`
+	Ref            string `json:"ref" yaml:"ref"`
+	Sha            string `json:"sha" yaml:"sha"`
+	Tag            string `json:"tag" yaml:"tag"`
+	TagDistance    int    `json:"tagDistance" yaml:"tagDistance"`
+	BuildNumber    string `json:"buildNumber" yaml:"buildNumber"`
+	CI             string `json:"ci" yaml:"ci"` // CI provider, empty outside of CI
+	PrNumber       string `json:"prNumber" yaml:"prNumber"`
+	PrSourceBranch string `json:"prSourceBranch" yaml:"prSourceBranch"`
+	PrTargetBranch string `json:"prTargetBranch" yaml:"prTargetBranch"`
+	Timestamp      string `json:"timestamp" yaml:"timestamp"`
+	Dirty          bool   `json:"dirty" yaml:"dirty"`
+}
+
+// Collects the report of the calculated version, the final one differs from it when the template is provided
+func collectReport(cfg *Config, source string, origin string, branch string, calculated string, final string) Report {
+	metadata := collectMetadata(cfg, origin, branch, calculated, nil)
+	report := Report{
+		Version:        final,
+		Origin:         origin,
+		Major:          metadata.Major,
+		Minor:          metadata.Minor,
+		Patch:          metadata.Patch,
+		Prerelease:     metadata.Prerelease,
+		Build:          metadata.Build,
+		Source:         source,
+		Profile:        cfg.traces["for"].Value,
+		Rule:           resolveStrategy(cfg, branch).Rule,
+		Branch:         metadata.GitBranch,
+		Ref:            metadata.GitRef,
+		Sha:            metadata.GitSha,
+		Tag:            metadata.GitTag,
+		TagDistance:    metadata.GitTagDistance,
+		BuildNumber:    metadata.BuildNumber,
+		PrNumber:       metadata.PrNumber,
+		PrSourceBranch: metadata.PrSourceBranch,
+		PrTargetBranch: metadata.PrTargetBranch,
+		Timestamp:      metadata.Timestamp,
+		Dirty:          metadata.Dirty,
+	}
+
+	if info, found := resolveBuildInfo(cfg); found {
+		report.CI = info.Provider
+	}
+
+	return report
+}
+
+// Renders the report in the output format
+func renderReport(report Report, output string) (string, error) {
+	switch output {
+	case "json":
+		content, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("Failed to render json: %v", err)
+		}
+		return string(content) + "\n", nil
+	case "yaml":
+		content, err := yaml.Marshal(report)
+		if err != nil {
+			return "", fmt.Errorf("Failed to render yaml: %v", err)
+		}
+		return string(content), nil
+	}
+	return report.Version, nil
+}
+
+func validateOutput(output string) error {
+	if len(output) > 0 && !contains(Outputs, output) {
+		return fmt.Errorf("Unknown output %q, available outputs: %s", output, strings.Join(Outputs, ", "))
+	}
+	return nil
+}
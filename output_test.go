@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestReport(t *testing.T) {
+	resolveGitSha = fakeGitSha
+	defer func() { resolveGitSha = defaultGitSha }()
+	resolveGitChanges = func() ([]GitChange, error) { return nil, nil }
+	defer func() { resolveGitChanges = defaultGitChanges }()
+	openGitRepository = func() (*GitRepository, error) { return nil, ErrNotGitRepository }
+	defer func() { openGitRepository = defaultOpenGitRepository }()
+	defer setCIEnv(map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/pull/42/merge", "GITHUB_HEAD_REF": "feature/x", "GITHUB_BASE_REF": "main", "GITHUB_RUN_NUMBER": "7"})()
+	os.Setenv("SOURCE_DATE_EPOCH", "1571307300")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	config := Config{gitRef: true, pullRequest: true}
+	config.trace("for", "npm", "flags")
+	calculated, err := Calculate(config, "1.4.0-SNAPSHOT", "feature/x")
+	assert.NilError(t, err)
+
+	report := collectReport(&config, "npm", "1.4.0-SNAPSHOT", "feature/x", calculated, "1.4")
+	assert.DeepEqual(t, Report{
+		Version:        "1.4",
+		Origin:         "1.4.0-SNAPSHOT",
+		Major:          1,
+		Minor:          4,
+		Patch:          0,
+		Prerelease:     "SNAPSHOT",
+		Source:         "npm",
+		Profile:        "npm",
+		Rule:           "pull-request",
+		Branch:         "feature/x",
+		Ref:            "feature-x",
+		Sha:            "1a2b3c",
+		BuildNumber:    "7",
+		CI:             "github",
+		PrNumber:       "42",
+		PrSourceBranch: "feature/x",
+		PrTargetBranch: "main",
+		Timestamp:      "20191017101500",
+	}, report)
+
+	var tests = []struct {
+		output   string
+		expected string
+	}{
+		{"", "1.4"},
+		{"text", "1.4"},
+		{"json", `{
+  "version": "1.4",
+  "origin": "1.4.0-SNAPSHOT",
+  "major": 1,
+  "minor": 4,
+  "patch": 0,
+  "prerelease": "SNAPSHOT",
+  "build": "",
+  "source": "npm",
+  "profile": "npm",
+  "rule": "pull-request",
+  "branch": "feature/x",
+  "ref": "feature-x",
+  "sha": "1a2b3c",
+  "tag": "",
+  "tagDistance": 0,
+  "buildNumber": "7",
+  "ci": "github",
+  "prNumber": "42",
+  "prSourceBranch": "feature/x",
+  "prTargetBranch": "main",
+  "timestamp": "20191017101500",
+  "dirty": false
+}
+`},
+		{"yaml", `version: "1.4"
+origin: 1.4.0-SNAPSHOT
+major: 1
+minor: 4
+patch: 0
+prerelease: SNAPSHOT
+build: ""
+source: npm
+profile: npm
+rule: pull-request
+branch: feature/x
+ref: feature-x
+sha: 1a2b3c
+tag: ""
+tagDistance: 0
+buildNumber: "7"
+ci: github
+prNumber: "42"
+prSourceBranch: feature/x
+prTargetBranch: main
+timestamp: "20191017101500"
+dirty: false
+`},
+	}
+
+	for _, test := range tests {
+		got, err := renderReport(report, test.output)
+		assert.NilError(t, err, "failed while testing "+test.output)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.output)
+	}
+
+	assert.Error(t, validateOutput("xml"), "Unknown output \"xml\", available outputs: text, json, yaml, docker")
+	assert.NilError(t, validateOutput(""))
+}
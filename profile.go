@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Profile is a named set of settings, which can be selected with "for"
+// F.e. a profile can extend a built-in one and override some of its settings:
+//
+//	profiles:
+//	  service:
+//	    extends: docker
+//	    git-sha: false
+type Profile struct {
+	Extends  string `yaml:"extends" toml:"extends"`
+	Settings `yaml:",inline"`
+}
+
+// Profiles contains the user-defined profiles together with the files they come from
+type Profiles struct {
+	profiles map[string]Profile
+	origins  map[string]string
+}
+
+// Layer of settings, which is applied on top of the config
+type layer struct {
+	settings Settings
+	origin   string
+}
+
+// Adds profiles from the file, overriding the ones with the same name
+func (p *Profiles) add(profiles map[string]Profile, origin string) {
+	if p.profiles == nil {
+		p.profiles, p.origins = map[string]Profile{}, map[string]string{}
+	}
+	for name, profile := range profiles {
+		p.profiles[name] = profile
+		p.origins[name] = origin
+	}
+}
+
+// Names returns both built-in and user-defined profile names
+func (p *Profiles) Names() []string {
+	var names []string
+	for name := range DefaultConfigs {
+		names = append(names, name)
+	}
+	for name := range p.profiles {
+		if _, found := DefaultConfigs[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve flattens the profile and everything it extends into the layers of settings, base first.
+// Besides the layers it returns the name of the built-in profile the chain ends with, if any.
+func (p *Profiles) Resolve(name string) ([]layer, string, error) {
+	return p.resolve(name, nil)
+}
+
+func (p *Profiles) resolve(name string, chain []string) ([]layer, string, error) {
+	for _, seen := range chain {
+		if seen == name {
+			return nil, "", fmt.Errorf("Profile %q extends itself: %s", name, strings.Join(append(chain, name), " -> "))
+		}
+	}
+
+	profile, found := p.profiles[name]
+	if !found {
+		return p.resolveBuiltIn(name)
+	}
+
+	self := layer{profile.Settings, "profile " + name + " from " + p.origins[name]}
+	if len(profile.Extends) == 0 {
+		return []layer{self}, "", nil
+	}
+
+	// User-defined profile may override the built-in one with the same name and extend it at the same time
+	if profile.Extends == name {
+		layers, builtIn, err := p.resolveBuiltIn(name)
+		return append(layers, self), builtIn, err
+	}
+
+	layers, builtIn, err := p.resolve(profile.Extends, append(chain, name))
+	return append(layers, self), builtIn, err
+}
+
+func (p *Profiles) resolveBuiltIn(name string) ([]layer, string, error) {
+	if config, found := DefaultConfigs[name]; found {
+		return []layer{{settingsOf(config), "profile " + name}}, name, nil
+	}
+	return nil, "", fmt.Errorf("Unknown profile %q, available profiles: %s", name, strings.Join(p.Names(), ", "))
+}
+
+// Returns the directory with the user-wide profiles, f.e. ~/.config/mkver
+func userProfilesDir() string {
+	if dir, found := os.LookupEnv("XDG_CONFIG_HOME"); found && len(dir) > 0 {
+		return filepath.Join(dir, "mkver")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "mkver")
+	}
+	return ""
+}
+
+// Loads the profiles from the files or directories with config files
+func loadProfiles(paths []string) (Profiles, error) {
+	var profiles Profiles
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		files := []string{path}
+		if info.IsDir() {
+			files = nil
+			entries, err := ioutil.ReadDir(path)
+			if err != nil {
+				return profiles, fmt.Errorf("Failed to read profiles from %s: %v", path, err)
+			}
+			for _, entry := range entries {
+				switch filepath.Ext(entry.Name()) {
+				case ".yml", ".yaml", ".toml":
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+
+		for _, file := range files {
+			settings, err := readSettingsFile(file)
+			if err != nil {
+				return profiles, err
+			}
+			profiles.add(settings.Profiles, file)
+		}
+	}
+
+	return profiles, nil
+}
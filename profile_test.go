@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestProfiles(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	writeFile(t, filepath.Join(dir, "org", "base.toml"), "[profiles.base]\nextends = \"npm\"\ngit-sha = true\n")
+	writeFile(t, filepath.Join(dir, "org", "docker.yml"), "profiles:\n  docker:\n    extends: docker\n    git-build-num: rc.\n")
+	writeFile(t, filepath.Join(dir, "cycle.yml"), "profiles:\n  a:\n    extends: b\n  b:\n    extends: a\n")
+	writeFile(t, filepath.Join(dir, "project.yml"), "profiles:\n  web:\n    extends: base\n    git-ref-ignore: [\"^main$\"]\n  service:\n    extends: docker\n")
+
+	profiles, err := loadProfiles([]string{filepath.Join(dir, "org"), filepath.Join(dir, "cycle.yml"), filepath.Join(dir, "project.yml"), filepath.Join(dir, "missing")})
+	assert.NilError(t, err)
+
+	var tests = []struct {
+		name     string
+		profile  string
+		expected Config
+		err      string
+	}{
+		{"built-in", "helm", DefaultConfigs["helm"], ""},
+		{"extends user-defined and built-in", "web", Config{gitRef: true, gitSha: true, gitRefIgnore: []string{"^main$"}}, ""},
+		{"overrides built-in", "service", Config{profile: "docker", gitSha: true, gitRef: true, gitRefIgnore: DefaultConfigs["docker"].gitRefIgnore, gitBuildNum: "rc."}, ""},
+		{"cycle", "a", Config{}, "Profile \"a\" extends itself: a -> b -> a"},
+		{"unknown", "x", Config{}, "Unknown profile \"x\", available profiles: a, b, base, docker, gradle, helm, npm, service, web"},
+	}
+
+	for _, test := range tests {
+		layers, builtIn, err := profiles.Resolve(test.profile)
+		if len(test.err) > 0 {
+			assert.Error(t, err, test.err, "failed while testing "+test.name)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+test.name)
+
+		var config Config
+		for _, l := range layers {
+			config.apply(l.settings, l.origin)
+		}
+		config.profile = DefaultConfigs[builtIn].profile
+		config.traces = nil
+		assert.DeepEqual(t, test.expected, config, cmpConfig)
+	}
+}
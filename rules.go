@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BranchRule tells how to version the branches matching the pattern.
+// Rules are evaluated in order and the first matching one wins. Values not set by the rule fall back to the flags.
+// F.e. release branches get the build number, but neither git ref, nor git sha:
+//
+//	rules:
+//	  - branch: ^release/
+//	    git-ref: false
+//	    git-build-num: rc.
+//	    git-sha: false
+type BranchRule struct {
+	Branch      string  `yaml:"branch" toml:"branch"`
+	GitRef      *bool   `yaml:"git-ref" toml:"git-ref"`
+	GitBuildNum *string `yaml:"git-build-num" toml:"git-build-num"`
+	GitSha      *bool   `yaml:"git-sha" toml:"git-sha"`
+	Prerelease  *string `yaml:"prerelease" toml:"prerelease"`
+	Snapshot    *bool   `yaml:"snapshot" toml:"snapshot"`
+}
+
+// Strategy is the set of enrichments applied to the version on a particular branch
+type Strategy struct {
+	GitRef      bool
+	GitBuildNum string // Build number label, f.e. "rc.", empty if build number is not added
+	GitSha      bool
+	Prerelease  string // Static prerelease label, f.e. "beta"
+	Snapshot    *bool  // Whether to add or strip the snapshot qualifier, original version is kept as is if not set
+	Rule        string // Pattern of the rule applied, if any
+}
+
+func rule(branch string, gitRef bool, gitBuildNum string, gitSha bool) BranchRule {
+	return BranchRule{Branch: branch, GitRef: &gitRef, GitBuildNum: &gitBuildNum, GitSha: &gitSha}
+}
+
+// Workflows contain pre-defined rules for the common branching models
+var Workflows = map[string][]BranchRule{
+	// master: 1.0.0, release/1.0.0: 1.0.0-rc.13, develop: 1.0.0-develop-b13, feature/x: 1.0.0-feature-x-1a2b3c
+	"gitflow": {
+		rule("^(master|main)$", false, "", false),
+		rule("^(release|hotfix)/", false, "rc.", false),
+		rule("^develop$", true, "b", false),
+		rule(".*", true, "", true),
+	},
+	// main: 1.0.0-b13, feature/x: 1.0.0-feature-x-1a2b3c
+	"trunk": {
+		rule("^(master|main|trunk)$", false, "b", false),
+		rule(".*", true, "", true),
+	},
+	// release/1.0: 1.0.0, main: 1.0.0-dev.13, feature/x: 1.0.0-feature-x-1a2b3c
+	"release-branch": {
+		rule("^release/", false, "", false),
+		rule("^(master|main)$", false, "dev.", false),
+		rule(".*", true, "", true),
+	},
+}
+
+// Returns the rules to evaluate: the configured ones first, then the ones of the workflow
+func (c *Config) branchRules() []BranchRule {
+	return append(append([]BranchRule{}, c.rules...), Workflows[c.workflow]...)
+}
+
+// Strategy resolves how to version the branch: from the first matching rule, falling back to the flags.
+// Tags (refs/tags/v1.0.0) are released as is, without enrichments and the snapshot qualifier, unless a configured rule matches them.
+func (c *Config) Strategy(branch string) Strategy {
+	s := Strategy{
+		GitRef: c.gitRef && !matchesAny(c.gitRefIgnore, branch),
+		GitSha: c.gitSha,
+	}
+	if len(c.gitBuildNumBranch) == 0 || matchesAny(c.gitBuildNumBranch, branch) {
+		s.GitBuildNum = c.gitBuildNum
+	}
+	if len(c.snapshot) > 0 {
+		s.Snapshot = boolOf(matchesAny(c.snapshot, branch))
+	}
+
+	rules := c.branchRules()
+	if strings.HasPrefix(branch, TagRefPrefix) {
+		s = Strategy{Snapshot: boolOf(false)}
+		rules = c.rules // catch-all rules of the workflows are meant for branches
+	}
+
+	for _, r := range rules {
+		if match, _ := regexp.MatchString(r.Branch, branch); !match {
+			continue
+		}
+		if r.GitRef != nil {
+			s.GitRef = *r.GitRef
+		}
+		if r.GitBuildNum != nil {
+			s.GitBuildNum = *r.GitBuildNum
+		}
+		if r.GitSha != nil {
+			s.GitSha = *r.GitSha
+		}
+		if r.Prerelease != nil {
+			s.Prerelease = *r.Prerelease
+		}
+		if r.Snapshot != nil {
+			s.Snapshot = r.Snapshot
+		}
+		s.Rule = r.Branch
+		break
+	}
+
+	return s
+}
+
+// Versions pull request builds as pr.<number>.<build number> without snapshot, f.e. 1.4.0-pr.123.7
+func pullRequestStrategy(info BuildInfo) Strategy {
+	buildNumber := info.BuildNumber
+	if len(buildNumber) == 0 {
+		buildNumber = "0"
+	}
+	return Strategy{
+		Prerelease: fmt.Sprintf("pr.%s.%s", info.PrNumber, buildNumber),
+		Snapshot:   boolOf(false),
+		Rule:       "pull-request",
+	}
+}
+
+// Validates the workflow name and the rule patterns
+func validateRules(workflow string, rules []BranchRule) error {
+	if _, found := Workflows[workflow]; len(workflow) > 0 && !found {
+		var names []string
+		for name := range Workflows {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("Unknown workflow %q, available workflows: %s", workflow, strings.Join(names, ", "))
+	}
+
+	for _, r := range rules {
+		if _, err := regexp.Compile(r.Branch); err != nil {
+			return fmt.Errorf("Invalid branch rule %q: %v", r.Branch, err)
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, branch string) bool {
+	for _, p := range patterns {
+		if match, _ := regexp.MatchString(p, branch); match {
+			return true
+		}
+	}
+	return false
+}
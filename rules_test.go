@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+var RuleTests = []struct {
+	name     string
+	config   Config
+	branch   string
+	version  string
+	expected string
+}{
+	// --workflow=gitflow
+	{"gitflow", Config{workflow: "gitflow"}, "master", "1.0.0", "1.0.0"},
+	{"gitflow", Config{workflow: "gitflow"}, "release/1.0.0", "1.0.0", "1.0.0-rc.13"},
+	{"gitflow", Config{workflow: "gitflow"}, "hotfix/1.0.1", "1.0.1", "1.0.1-rc.13"},
+	{"gitflow", Config{workflow: "gitflow"}, "develop", "1.0.0", "1.0.0-develop-b13"},
+	{"gitflow", Config{workflow: "gitflow"}, "feature/X", "1.0.0", "1.0.0-feature-x-1a2b3c"},
+
+	// --workflow=trunk
+	{"trunk", Config{workflow: "trunk"}, "main", "1.0.0", "1.0.0-b13"},
+	{"trunk", Config{workflow: "trunk"}, "fix/y", "1.0.0", "1.0.0-fix-y-1a2b3c"},
+
+	// --workflow=release-branch
+	{"release-branch", Config{workflow: "release-branch"}, "release/1.0", "1.0.0", "1.0.0"},
+	{"release-branch", Config{workflow: "release-branch"}, "main", "1.1.0", "1.1.0-dev.13"},
+
+	// First matching rule wins, even if the following ones match as well
+	{"first match", Config{rules: []BranchRule{rule("^release/", false, "rc.", false), rule("^release/1", true, "", true)}}, "release/1.0.0", "1.0.0", "1.0.0-rc.13"},
+
+	// Configured rules take precedence over the workflow
+	{"rules over workflow", Config{workflow: "gitflow", rules: []BranchRule{rule("^master$", false, "b", false)}}, "master", "1.0.0", "1.0.0-b13"},
+
+	// Values not set by the rule fall back to the flags
+	{"fallback to flags", Config{gitRef: true, gitSha: true, rules: []BranchRule{{Branch: "^feature/", GitSha: boolOf(false)}}}, "feature/x", "1.0.0", "1.0.0-feature-x"},
+	{"no matching rule", Config{gitRef: true, rules: []BranchRule{rule("^release/", false, "rc.", false)}}, "feature/x", "1.0.0", "1.0.0-feature-x"},
+
+	// Static prerelease label
+	{"prerelease", Config{rules: []BranchRule{{Branch: "^beta/", Prerelease: stringOf("beta"), GitBuildNum: stringOf("b")}}}, "beta/x", "1.0.0", "1.0.0-beta-b13"},
+
+	// Tags are released as is
+	{"tag", Config{gitRef: true, gitSha: true, gitBuildNum: "rc."}, "refs/tags/v1.0.0", "1.0.0", "1.0.0"},
+	{"tag: snapshot", Config{snapshot: []string{".*"}}, "refs/tags/v1.0.0", "1.0.0-SNAPSHOT", "1.0.0"},
+	{"tag: prerelease", Config{workflow: "gitflow"}, "refs/tags/v1.0.0-rc.1", "1.0.0-rc.1", "1.0.0-rc.1"},
+	{"tag: rule", Config{workflow: "gitflow", rules: []BranchRule{{Branch: "^refs/tags/", GitRef: boolOf(true)}}}, "refs/tags/v1.0.0", "1.0.0", "1.0.0-v1.0.0"},
+}
+
+func TestRules(t *testing.T) {
+	// prepare
+	resolveGitSha = fakeGitSha
+	defer func() { resolveGitSha = defaultGitSha }()
+	defer setCIEnv(map[string]string{"BUILD_NUMBER": "13"})()
+
+	// execute
+	for _, test := range RuleTests {
+		got, err := Calculate(test.config, test.version, test.branch)
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.name+" on "+test.branch)
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	assert.NilError(t, validateRules("gitflow", []BranchRule{{Branch: "^release/"}}))
+	assert.Error(t, validateRules("unknown", nil), "Unknown workflow \"unknown\", available workflows: gitflow, release-branch, trunk")
+	assert.ErrorContains(t, validateRules("", []BranchRule{{Branch: "^release/("}}), "Invalid branch rule \"^release/(\"")
+}
+
+func TestPullRequest(t *testing.T) {
+	pr := map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/pull/42/merge", "GITHUB_HEAD_REF": "feature/x", "GITHUB_BASE_REF": "main", "GITHUB_RUN_NUMBER": "7"}
+	push := map[string]string{"GITHUB_ACTIONS": "true", "GITHUB_REF": "refs/heads/feature/x", "GITHUB_RUN_NUMBER": "7"}
+	resolveGitSha = fakeGitSha
+	defer func() { resolveGitSha = defaultGitSha }()
+
+	var tests = []struct {
+		name     string
+		env      map[string]string
+		config   Config
+		version  string
+		expected string
+	}{
+		{"pull request", pr, Config{pullRequest: true, gitRef: true, gitSha: true}, "1.4.0", "1.4.0-pr.42.7"},
+		{"pull request: snapshot", pr, Config{pullRequest: true, gitRef: true}, "1.4.0-SNAPSHOT", "1.4.0-pr.42.7"},
+		{"pull request: overrides rules", pr, Config{pullRequest: true, workflow: "gitflow"}, "1.4.0", "1.4.0-pr.42.7"},
+		{"pull request: docker", pr, Config{pullRequest: true, profile: "docker", gitSha: true}, "1.4.0", "1.4.0-pr.42.7"},
+		{"pull request: disabled", pr, Config{gitRef: true}, "1.4.0-SNAPSHOT", "1.4.0-feature-x-SNAPSHOT"},
+		{"branch build", push, Config{pullRequest: true, gitRef: true}, "1.4.0-SNAPSHOT", "1.4.0-feature-x-SNAPSHOT"},
+	}
+
+	for _, test := range tests {
+		restore := setCIEnv(test.env)
+		got, err := Calculate(test.config, test.version, "feature/x")
+		restore()
+
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
+	}
+
+	// Pull request fields of the template
+	defer setCIEnv(pr)()
+	metadata := collectMetadata(&Config{}, "1.4.0", "feature/x", "1.4.0", nil)
+	assert.Equal(t, "42", metadata.PrNumber)
+	assert.Equal(t, "feature/x", metadata.PrSourceBranch)
+	assert.Equal(t, "main", metadata.PrTargetBranch)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SemVer is the representation of a semantic version as defined by https://semver.org/spec/v2.0.0.html
+// F.e. 1.0.0-rc.1+git.1a2b3c => Major: 1, Minor: 0, Patch: 0, Prerelease: [rc 1], Build: [git 1a2b3c]
+type SemVer struct {
+	Major, Minor, Patch uint64
+	Prerelease          []string
+	Build               []string
+}
+
+// SemVerError describes why a version string is not a valid semantic version
+type SemVerError struct {
+	Version string
+	Reason  string
+}
+
+func (e *SemVerError) Error() string {
+	return fmt.Sprintf("Invalid semantic version %q: %s", e.Version, e.Reason)
+}
+
+// ParseSemVer parses the version string strictly following the SemVer 2.0.0 grammar
+func ParseSemVer(version string) (SemVer, error) {
+	return parseSemVer(version, false)
+}
+
+// ParseSemVerLenient parses the version string, tolerating the most common deviations from SemVer 2.0.0:
+// surrounding whitespace, a leading "v", missing minor or patch parts and leading zeros.
+// F.e. v1.2 => 1.2.0, 1.02.3-SNAPSHOT => 1.2.3-SNAPSHOT
+func ParseSemVerLenient(version string) (SemVer, error) {
+	return parseSemVer(version, true)
+}
+
+func parseSemVer(version string, lenient bool) (SemVer, error) {
+	var v SemVer
+
+	s := version
+	if lenient {
+		s = strings.TrimSpace(s)
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	}
+
+	if len(s) == 0 {
+		return v, &SemVerError{version, "empty version"}
+	}
+
+	// Split off build metadata first, as it may contain "-"
+	if plus := strings.Index(s, "+"); plus >= 0 {
+		build := s[plus+1:]
+		s = s[:plus]
+		if len(build) == 0 {
+			return v, &SemVerError{version, "empty build metadata"}
+		}
+		v.Build = strings.Split(build, ".")
+		for _, id := range v.Build {
+			if err := validateIdentifier(id, false); err != nil {
+				return v, &SemVerError{version, "build metadata " + err.Error()}
+			}
+		}
+	}
+
+	// Everything after the first "-" is a prerelease, even if it contains more of them
+	if dash := strings.Index(s, "-"); dash >= 0 {
+		prerelease := s[dash+1:]
+		s = s[:dash]
+		if len(prerelease) == 0 {
+			return v, &SemVerError{version, "empty prerelease"}
+		}
+		v.Prerelease = strings.Split(prerelease, ".")
+		for i, id := range v.Prerelease {
+			if err := validateIdentifier(id, !lenient); err != nil {
+				return v, &SemVerError{version, "prerelease " + err.Error()}
+			}
+			if lenient && isNumeric(id) {
+				v.Prerelease[i] = trimLeadingZeros(id)
+			}
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 || (!lenient && len(parts) != 3) {
+		return v, &SemVerError{version, "expected MAJOR.MINOR.PATCH"}
+	}
+	for len(parts) < 3 {
+		parts = append(parts, "0")
+	}
+
+	numbers := make([]uint64, 3)
+	for i, part := range parts {
+		if !isNumeric(part) {
+			return v, &SemVerError{version, fmt.Sprintf("%q is not a number", part)}
+		}
+		if !lenient && len(part) > 1 && part[0] == '0' {
+			return v, &SemVerError{version, fmt.Sprintf("%q has a leading zero", part)}
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return v, &SemVerError{version, fmt.Sprintf("%q is out of range", part)}
+		}
+		numbers[i] = n
+	}
+	v.Major, v.Minor, v.Patch = numbers[0], numbers[1], numbers[2]
+
+	return v, nil
+}
+
+// Validates a single dot-separated identifier of the prerelease or build metadata
+func validateIdentifier(id string, strictNumeric bool) error {
+	if len(id) == 0 {
+		return fmt.Errorf("contains an empty identifier")
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+			return fmt.Errorf("identifier %q contains invalid character %q", id, r)
+		}
+	}
+	if strictNumeric && isNumeric(id) && len(id) > 1 && id[0] == '0' {
+		return fmt.Errorf("numeric identifier %q has a leading zero", id)
+	}
+	return nil
+}
+
+func isNumeric(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func trimLeadingZeros(s string) string {
+	trimmed := strings.TrimLeft(s, "0")
+	if len(trimmed) == 0 {
+		return "0"
+	}
+	return trimmed
+}
+
+// String formats the version back according to SemVer 2.0.0
+func (v SemVer) String() string {
+	var b strings.Builder
+	b.WriteString(v.Core())
+	if len(v.Prerelease) > 0 {
+		b.WriteString("-" + strings.Join(v.Prerelease, "."))
+	}
+	if len(v.Build) > 0 {
+		b.WriteString("+" + strings.Join(v.Build, "."))
+	}
+	return b.String()
+}
+
+// Core returns MAJOR.MINOR.PATCH part of the version
+func (v SemVer) Core() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// IsPrerelease reports whether the version has prerelease identifiers
+func (v SemVer) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// AppendQualifier appends a "-" separated qualifier to the prerelease, the way mkver enriches versions.
+// F.e. 1.0.0 + feature-x => 1.0.0-feature-x, 1.0.0-feature-x + rc.13 => 1.0.0-feature-x-rc.13
+func (v *SemVer) AppendQualifier(qualifier string) {
+	if len(qualifier) == 0 {
+		return
+	}
+	prerelease := strings.Join(v.Prerelease, ".")
+	if len(prerelease) > 0 {
+		prerelease += "-"
+	}
+	v.Prerelease = strings.Split(prerelease+qualifier, ".")
+}
+
+// Compare compares versions by SemVer 2.0.0 precedence, returning -1, 0 or +1. Build metadata is ignored.
+func (v SemVer) Compare(o SemVer) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	// A version without prerelease has higher precedence
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		a, b := v.Prerelease[i], o.Prerelease[i]
+		aNum, bNum := isNumeric(a), isNumeric(b)
+		switch {
+		case aNum && bNum:
+			an, _ := strconv.ParseUint(a, 10, 64)
+			bn, _ := strconv.ParseUint(b, 10, 64)
+			if c := compareUint(an, bn); c != 0 {
+				return c
+			}
+		case aNum:
+			return -1
+		case bNum:
+			return 1
+		default:
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return compareUint(uint64(len(v.Prerelease)), uint64(len(o.Prerelease)))
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// IncMajor returns the next major version. Prerelease of a major version is released as is.
+// F.e. 1.2.3 => 2.0.0, 2.0.0-rc.1 => 2.0.0
+func (v SemVer) IncMajor() SemVer {
+	if !v.IsPrerelease() || v.Minor != 0 || v.Patch != 0 {
+		v.Major, v.Minor, v.Patch = v.Major+1, 0, 0
+	}
+	v.Prerelease, v.Build = nil, nil
+	return v
+}
+
+// IncMinor returns the next minor version. Prerelease of a minor version is released as is.
+// F.e. 1.2.3 => 1.3.0, 1.3.0-rc.1 => 1.3.0
+func (v SemVer) IncMinor() SemVer {
+	if !v.IsPrerelease() || v.Patch != 0 {
+		v.Minor, v.Patch = v.Minor+1, 0
+	}
+	v.Prerelease, v.Build = nil, nil
+	return v
+}
+
+// IncPatch returns the next patch version. Prerelease is released as is.
+// F.e. 1.2.3 => 1.2.4, 1.2.4-rc.1 => 1.2.4
+func (v SemVer) IncPatch() SemVer {
+	if !v.IsPrerelease() {
+		v.Patch++
+	}
+	v.Prerelease, v.Build = nil, nil
+	return v
+}
+
+// IncPrerelease returns the next prerelease version, incrementing its last numeric identifier.
+// A release version gets the next patch prerelease, a different preid starts the prerelease over.
+// F.e. 1.2.3-rc.4 => 1.2.3-rc.5, 1.2.3 => 1.2.4-rc.0 (preid rc), 1.2.3-alpha.2 => 1.2.3-beta.0 (preid beta)
+func (v SemVer) IncPrerelease(preid string) SemVer {
+	v.Build = nil
+	switch {
+	case !v.IsPrerelease():
+		v.Patch++
+		v.Prerelease = prereleaseOf(preid)
+		return v
+	case len(preid) > 0 && v.Prerelease[0] != preid:
+		v.Prerelease = prereleaseOf(preid)
+		return v
+	}
+
+	prerelease := append([]string{}, v.Prerelease...)
+	for i := len(prerelease) - 1; i >= 0; i-- {
+		if isNumeric(prerelease[i]) {
+			n, _ := strconv.ParseUint(prerelease[i], 10, 64)
+			prerelease[i] = strconv.FormatUint(n+1, 10)
+			v.Prerelease = prerelease
+			return v
+		}
+	}
+	v.Prerelease = append(prerelease, "0")
+	return v
+}
+
+// Returns the first prerelease of the preid, f.e. rc.0, or just 0 without preid
+func prereleaseOf(preid string) []string {
+	if len(preid) == 0 {
+		return []string{"0"}
+	}
+	return []string{preid, "0"}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+var SemVerTests = []struct {
+	name     string
+	version  string
+	lenient  bool
+	expected string
+	valid    bool
+}{
+	{"core", "1.0.0", false, "1.0.0", true},
+	{"prerelease", "1.0.0-rc.1", false, "1.0.0-rc.1", true},
+	{"multi-part prerelease", "1.0.0-rc.1-SNAPSHOT", false, "1.0.0-rc.1-SNAPSHOT", true},
+	{"build metadata", "1.0.0-rc.1+git.1a2b3c", false, "1.0.0-rc.1+git.1a2b3c", true},
+	{"build metadata with dash", "1.0.0+exp-sha.5114f85", false, "1.0.0+exp-sha.5114f85", true},
+
+	{"strict: leading v", "v1.0.0", false, "", false},
+	{"strict: missing patch", "1.0", false, "", false},
+	{"strict: leading zero", "01.0.0", false, "", false},
+	{"strict: leading zero in prerelease", "1.0.0-rc.01", false, "", false},
+	{"strict: empty prerelease identifier", "1.0.0-rc..1", false, "", false},
+	{"strict: invalid character", "1.0.0-rc_1", false, "", false},
+	{"strict: empty build", "1.0.0+", false, "", false},
+	{"strict: not a number", "1.x.0", false, "", false},
+	{"strict: empty", "", false, "", false},
+
+	{"lenient: leading v", "v1.0.0", true, "1.0.0", true},
+	{"lenient: missing patch", " 1.2 ", true, "1.2.0", true},
+	{"lenient: leading zero", "1.02.3-rc.01", true, "1.2.3-rc.1", true},
+	{"lenient: too many parts", "1.2.3.4", true, "", false},
+}
+
+func TestSemVer(t *testing.T) {
+	for _, test := range SemVerTests {
+		var got SemVer
+		var err error
+		if test.lenient {
+			got, err = ParseSemVerLenient(test.version)
+		} else {
+			got, err = ParseSemVer(test.version)
+		}
+
+		assert.Equal(t, test.valid, err == nil, "failed while testing "+test.name)
+		if test.valid {
+			assert.Equal(t, test.expected, got.String(), "failed while testing "+test.name)
+		}
+	}
+}
+
+func TestSemVerCompare(t *testing.T) {
+	// Example from https://semver.org/spec/v2.0.0.html#spec-item-11
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "2.0.0"}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		a, _ := ParseSemVer(ordered[i])
+		b, _ := ParseSemVer(ordered[i+1])
+		assert.Equal(t, -1, a.Compare(b), ordered[i]+" < "+ordered[i+1])
+		assert.Equal(t, 1, b.Compare(a), ordered[i+1]+" > "+ordered[i])
+	}
+
+	a, _ := ParseSemVer("1.0.0+a")
+	b, _ := ParseSemVer("1.0.0+b")
+	assert.Equal(t, 0, a.Compare(b), "build metadata is ignored")
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// VersionSource resolves the original version, which is enriched afterwards
+type VersionSource interface {
+	// Name of the source, f.e. "gradle"
+	Name() string
+	// Resolve returns the version or the reason why it can't be resolved
+	Resolve(cfg *Config) (string, error)
+}
+
+// VersionWriter is implemented by the sources and the manifests, which the version can be written to
+type VersionWriter interface {
+	// Rewrite returns the file holding the version and its content with the version replaced, keeping the rest of it intact
+	Rewrite(cfg *Config, version string) (string, []byte, error)
+}
+
+// VersionSources contains the registered sources by their names
+var VersionSources = map[string]VersionSource{}
+
+// DefaultSourceOrder is the order the sources are tried in, unless configured otherwise
+var DefaultSourceOrder = []string{"env", "gradle", "maven", "npm", "git-tag"}
+
+// RegisterVersionSource makes the source available for the resolution
+func RegisterVersionSource(source VersionSource) {
+	VersionSources[source.Name()] = source
+}
+
+func init() {
+	RegisterVersionSource(envSource{})
+	RegisterVersionSource(gradleSource{})
+	RegisterVersionSource(mavenSource{})
+	RegisterVersionSource(npmSource{})
+	RegisterVersionSource(gitTagSource{})
+}
+
+// SourceError lists every source tried and why it failed
+type SourceError struct {
+	Errors map[string]error
+	Order  []string
+}
+
+func (e *SourceError) Error() string {
+	var b strings.Builder
+	b.WriteString("Failed to resolve version, tried:")
+	for _, name := range e.Order {
+		fmt.Fprintf(&b, "\n  %s: %v", name, e.Errors[name])
+	}
+	return b.String()
+}
+
+// Resolves original version from one of the sources and returns the name of the source used.
+// The source is either forced with "--source" (or one of the source flags, f.e. "--gradle"),
+// or the first one succeeding in the configured order.
+func resolveVersion(cfg *Config) (string, string, error) {
+	order := cfg.sources
+	if len(order) == 0 {
+		order = DefaultSourceOrder
+	}
+	if forced := forcedSource(cfg); len(forced) > 0 {
+		order = []string{forced}
+	}
+
+	sourceErr := &SourceError{Errors: map[string]error{}}
+	for _, name := range order {
+		version, err := VersionSources[name].Resolve(cfg)
+		if err == nil {
+			return version, name, nil
+		}
+		sourceErr.Errors[name] = err
+		sourceErr.Order = append(sourceErr.Order, name)
+	}
+
+	return "", "", sourceErr
+}
+
+// Returns the source, which is forced either explicitly or by specifying its location
+func forcedSource(cfg *Config) string {
+	switch {
+	case len(cfg.source) > 0:
+		return cfg.source
+	case len(cfg.env) > 0:
+		return "env"
+	case len(cfg.gradle) > 0:
+		return "gradle"
+	case len(cfg.maven) > 0:
+		return "maven"
+	case len(cfg.npm) > 0 || len(cfg.npmWorkspace) > 0:
+		return "npm"
+	case cfg.gitTag:
+		return "git-tag"
+	}
+	return ""
+}
+
+// Validates that the forced source and the source order reference the registered sources only
+func validateSources(source string, order []string) error {
+	for _, name := range append([]string{source}, order...) {
+		if _, found := VersionSources[name]; len(name) > 0 && !found {
+			var names []string
+			for name := range VersionSources {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("Unknown version source %q, available sources: %s", name, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// Returns the configured value or the default one
+func valueOr(value string, def string) string {
+	if len(value) == 0 {
+		return def
+	}
+	return value
+}
+
+// Resolves version from the env variable, $VERSION by default
+type envSource struct{}
+
+func (envSource) Name() string {
+	return "env"
+}
+
+func (envSource) Resolve(cfg *Config) (string, error) {
+	name := valueOr(cfg.env, EnvFlag.Value)
+	if val, found := os.LookupEnv(name); found {
+		return val, nil
+	}
+	return "", fmt.Errorf("env variable $%s is not set", name)
+}
+
+// Resolves version from the gradle properties file, gradle.properties by default
+type gradleSource struct{}
+
+func (gradleSource) Name() string {
+	return "gradle"
+}
+
+func (gradleSource) Resolve(cfg *Config) (string, error) {
+	path := valueOr(cfg.gradle, GradleFlag.Value)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("%s not found", path)
+	}
+
+	gradleProperties, err := readPropertiesFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if version, found := gradleProperties["version"]; found && len(version) > 0 {
+		return version, nil
+	}
+	return "", fmt.Errorf("%s has no version property", path)
+}
+
+func (gradleSource) Rewrite(cfg *Config, version string) (string, []byte, error) {
+	path := valueOr(cfg.gradle, GradleFlag.Value)
+	content, err := rewritePropertiesFile(path, "version", version)
+	return path, content, err
+}
+
+// Resolves version from the maven pom.xml, pom.xml by default
+type mavenSource struct{}
+
+func (mavenSource) Name() string {
+	return "maven"
+}
+
+func (mavenSource) Resolve(cfg *Config) (string, error) {
+	path := valueOr(cfg.maven, MavenFlag.Value)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("%s not found", path)
+	}
+	return resolvePomVersion(path)
+}
+
+func (mavenSource) Rewrite(cfg *Config, version string) (string, []byte, error) {
+	return rewritePomVersion(valueOr(cfg.maven, MavenFlag.Value), version)
+}
+
+// Resolves version from package.json or from one of its workspaces, package.json by default
+type npmSource struct{}
+
+func (npmSource) Name() string {
+	return "npm"
+}
+
+func (npmSource) Resolve(cfg *Config) (string, error) {
+	path := valueOr(cfg.npm, NpmFlag.Value)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("%s not found", path)
+	}
+	return resolvePackageJSONVersion(path, cfg.npmWorkspace)
+}
+
+func (npmSource) Rewrite(cfg *Config, version string) (string, []byte, error) {
+	path := valueOr(cfg.npm, NpmFlag.Value)
+	if len(cfg.npmWorkspace) > 0 {
+		pkg, root, err := readPackageJSON(path)
+		if err != nil {
+			return path, nil, err
+		}
+		member, found := workspaceMembers(pkg, root)[cfg.npmWorkspace]
+		if !found {
+			return path, nil, fmt.Errorf("workspace %q not found", cfg.npmWorkspace)
+		}
+		path = member
+	}
+	return rewritePackageJSONVersion(path, version)
+}
+
+// Resolves version from the nearest git tag reachable from HEAD
+type gitTagSource struct{}
+
+func (gitTagSource) Name() string {
+	return "git-tag"
+}
+
+func (gitTagSource) Resolve(cfg *Config) (string, error) {
+	description, err := describeGitTag(cfg.gitTagPrefix)
+	if err != nil {
+		return "", err
+	}
+	return description.VersionFor(cfg.gitTagMode)
+}
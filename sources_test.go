@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestResolveVersion(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	assert.NilError(t, os.Chdir(dir))
+
+	os.Unsetenv("VERSION")
+
+	writeFile(t, filepath.Join(dir, "gradle.properties"), "# comment\nversion=1.0.0-SNAPSHOT\n")
+	writeFile(t, filepath.Join(dir, "package.json"), `{"version": "2.0.0"}`)
+	writeFile(t, filepath.Join(dir, "app.properties"), "name=app\n")
+
+	var tests = []struct {
+		name     string
+		config   Config
+		expected string
+		source   string
+		err      string
+	}{
+		{"default order", Config{}, "1.0.0-SNAPSHOT", "gradle", ""},
+		{"configured order", Config{sources: []string{"git-tag", "npm", "gradle"}}, "2.0.0", "npm", ""},
+		{"forced source", Config{source: "npm"}, "2.0.0", "npm", ""},
+		{"forced by location", Config{npm: "package.json"}, "2.0.0", "npm", ""},
+		{"forced source failure", Config{source: "maven"}, "", "", "Failed to resolve version, tried:\n  maven: pom.xml not found"},
+		{"all failed", Config{sources: []string{"env", "maven", "git-tag"}, gitTagPrefix: "v"}, "", "",
+			"Failed to resolve version, tried:\n  env: env variable $VERSION is not set\n  maven: pom.xml not found\n  git-tag: Failed to resolve version from git tags: not a git repository"},
+		{"no version property", Config{gradle: "app.properties"}, "", "", "Failed to resolve version, tried:\n  gradle: app.properties has no version property"},
+	}
+
+	for _, test := range tests {
+		got, source, err := resolveVersion(&test.config)
+		if len(test.err) > 0 {
+			assert.Error(t, err, test.err, "failed while testing "+test.name)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
+		assert.Equal(t, test.source, source, "failed while testing "+test.name)
+	}
+
+	os.Setenv("VERSION", "3.0.0")
+	defer os.Unsetenv("VERSION")
+	got, source, err := resolveVersion(&Config{})
+	assert.NilError(t, err)
+	assert.Equal(t, "3.0.0", got)
+	assert.Equal(t, "env", source)
+}
+
+func TestValidateSources(t *testing.T) {
+	assert.NilError(t, validateSources("", []string{"gradle", "git-tag"}))
+	assert.Error(t, validateSources("svn", nil), "Unknown version source \"svn\", available sources: env, git-tag, gradle, maven, npm")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampLayouts are the named layouts of the timestamp, Go layouts can be used as well
+var TimestampLayouts = map[string]string{
+	"yyyyMMddHHmmss": "20060102150405",
+	"iso-basic":      "20060102T150405Z",
+	"unix":           "", // seconds since epoch
+}
+
+// Clocks tell where the time of the build is taken from
+var Clocks = []string{"commit", "now", "source-date-epoch"}
+
+// Resolves the time of the build, always in UTC:
+// "commit" => committer time of HEAD, so that the same commit always yields the same version,
+// "now" => current time, "source-date-epoch" => $SOURCE_DATE_EPOCH.
+// If the clock is not configured, $SOURCE_DATE_EPOCH is used when set, current time otherwise.
+func resolveTimestamp(cfg *Config) (time.Time, error) {
+	clock := cfg.clock
+	if len(clock) == 0 {
+		clock = "now"
+		if _, found := os.LookupEnv("SOURCE_DATE_EPOCH"); found {
+			clock = "source-date-epoch"
+		}
+	}
+
+	switch clock {
+	case "now":
+		return now(), nil
+	case "source-date-epoch":
+		value, found := os.LookupEnv("SOURCE_DATE_EPOCH")
+		if !found {
+			return time.Time{}, fmt.Errorf("Failed to resolve timestamp: env variable $SOURCE_DATE_EPOCH is not set")
+		}
+		seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Failed to resolve timestamp: $SOURCE_DATE_EPOCH %q is not a number of seconds", value)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	case "commit":
+		repo, err := openGitRepository()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Failed to resolve timestamp of the commit: %v", err)
+		}
+		defer repo.Close()
+		_, sha, err := repo.Head()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Failed to resolve timestamp of the commit: %v", err)
+		}
+		if len(sha) == 0 {
+			return time.Time{}, fmt.Errorf("Failed to resolve timestamp of the commit: the branch has no commits yet")
+		}
+		commit, err := repo.Commit(sha)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Failed to resolve timestamp of the commit: %v", err)
+		}
+		return commit.Time, nil
+	}
+	return time.Time{}, fmt.Errorf("Unknown clock %q, available clocks: %s", clock, strings.Join(Clocks, ", "))
+}
+
+// Parses the timestamp formatted with one of the named layouts or RFC 3339, the result is in UTC
+func parseTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{TimestampLayouts["yyyyMMddHHmmss"], TimestampLayouts["iso-basic"], time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("Failed to parse timestamp %q: use yyyyMMddHHmmss, iso-basic, unix or RFC 3339", value)
+}
+
+// Formats the time using the named or Go layout, "yyyyMMddHHmmss" by default
+func formatTimestamp(t time.Time, layout string) string {
+	if len(layout) == 0 {
+		layout = TimestampLayoutFlag.Value
+	}
+	if layout == "unix" {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	if named, found := TimestampLayouts[layout]; found {
+		layout = named
+	}
+	return t.UTC().Format(layout)
+}
+
+// Validates the clock and the layout, which has to produce a valid prerelease identifier
+func validateTimestamp(clock string, layout string) error {
+	if len(clock) > 0 && !contains(Clocks, clock) {
+		return fmt.Errorf("Unknown clock %q, available clocks: %s", clock, strings.Join(Clocks, ", "))
+	}
+	if _, found := TimestampLayouts[layout]; len(layout) == 0 || found {
+		return nil
+	}
+	// Numeric identifiers must not have leading zeros, f.e. "0102150405" yields 0101010101 on 2001-01-01 01:01:01
+	invalid := false
+	for _, reference := range []time.Time{time.Date(2019, 10, 17, 10, 15, 0, 0, time.UTC), time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC)} {
+		formatted := formatTimestamp(reference, layout)
+		if formatted == layout || validateIdentifier(formatted, true) != nil {
+			invalid = true
+		}
+	}
+	if invalid {
+		names := make([]string, 0, len(TimestampLayouts))
+		for name := range TimestampLayouts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("Invalid timestamp layout %q: use one of %s or Go layout producing only alphanumerics and hyphens, numbers without leading zeros", layout, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
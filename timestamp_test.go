@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	timestamp := time.Date(2019, 10, 17, 10, 15, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	var tests = []struct {
+		layout   string
+		expected string
+	}{
+		{"", "20191017081500"},
+		{"yyyyMMddHHmmss", "20191017081500"},
+		{"iso-basic", "20191017T081500Z"},
+		{"unix", "1571300100"},
+		{"20060102", "20191017"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, formatTimestamp(timestamp, test.layout), "failed while testing "+test.layout)
+	}
+}
+
+func TestValidateTimestamp(t *testing.T) {
+	assert.NilError(t, validateTimestamp("", ""))
+	assert.NilError(t, validateTimestamp("commit", "unix"))
+	assert.NilError(t, validateTimestamp("now", "2006-01-02"))
+	assert.Error(t, validateTimestamp("sundial", ""), "Unknown clock \"sundial\", available clocks: commit, now, source-date-epoch")
+	assert.ErrorContains(t, validateTimestamp("", "2006-01-02T15:04:05"), "Invalid timestamp layout \"2006-01-02T15:04:05\"")
+	assert.ErrorContains(t, validateTimestamp("", "yyyy"), "Invalid timestamp layout \"yyyy\"")
+	assert.ErrorContains(t, validateTimestamp("", "0102150405"), "Invalid timestamp layout \"0102150405\"")
+	assert.NilError(t, validateTimestamp("", "060102-1504"))
+}
+
+func TestResolveTimestamp(t *testing.T) {
+	dir, git, cleanup := gitFixture(t)
+	defer cleanup()
+	git("commit", "-q", "--allow-empty", "-m", "1")
+
+	openGitRepository = func() (*GitRepository, error) { return OpenGitRepository(dir) }
+	defer func() { openGitRepository = defaultOpenGitRepository }()
+
+	epoch, found := os.LookupEnv("SOURCE_DATE_EPOCH")
+	defer func() {
+		os.Unsetenv("SOURCE_DATE_EPOCH")
+		if found {
+			os.Setenv("SOURCE_DATE_EPOCH", epoch)
+		}
+	}()
+
+	// Commit time is the one of the fixture
+	got, err := resolveTimestamp(&Config{clock: "commit"})
+	assert.NilError(t, err)
+	assert.Equal(t, time.Date(2019, 10, 17, 10, 0, 0, 0, time.UTC), got)
+
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+	_, err = resolveTimestamp(&Config{clock: "source-date-epoch"})
+	assert.Error(t, err, "Failed to resolve timestamp: env variable $SOURCE_DATE_EPOCH is not set")
+	got, err = resolveTimestamp(&Config{})
+	assert.NilError(t, err)
+	assert.Assert(t, time.Since(got) < time.Minute, "current time is used by default")
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1571300100")
+	got, err = resolveTimestamp(&Config{})
+	assert.NilError(t, err)
+	assert.Equal(t, time.Date(2019, 10, 17, 8, 15, 0, 0, time.UTC), got)
+	got, err = resolveTimestamp(&Config{clock: "now"})
+	assert.NilError(t, err)
+	assert.Assert(t, time.Since(got) < time.Minute, "current time is forced")
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = resolveTimestamp(&Config{})
+	assert.Error(t, err, "Failed to resolve timestamp: $SOURCE_DATE_EPOCH \"yesterday\" is not a number of seconds")
+
+	// Same commit yields the same version
+	version, err := Calculate(Config{timestamp: true, clock: "commit", timestampLayout: "iso-basic"}, "1.0.0-SNAPSHOT", "develop")
+	assert.NilError(t, err)
+	assert.Equal(t, "1.0.0-20191017T100000Z-SNAPSHOT", version)
+}
@@ -10,15 +10,33 @@ package main
 
 import (
 	"bytes"
-	"log"
+	"fmt"
 	"text/template"
+	"text/template/parse"
 )
 
 // Metadata - container of version meta-information such as origin version, git branch, etc.
 type Metadata struct {
-	Origin    string
-	GitBranch string
-	GitSha    string
+	Origin  string // Original version, f.e. 1.0.0-SNAPSHOT
+	Version string // Version calculated from the flags, f.e. 1.0.0-feature-x-SNAPSHOT
+
+	// Components of the original version
+	Major, Minor, Patch uint64
+	Prerelease          string
+	Build               string
+
+	GitBranch      string // Branch as is, f.e. feature/X
+	GitRef         string // Branch sanitized for the version, f.e. feature-x
+	GitSha         string
+	GitTag         string // Nearest reachable version tag, f.e. v1.4.2
+	GitTagDistance int    // Number of commits since GitTag
+	GitTagExact    bool   // Whether HEAD is exactly on GitTag
+	BuildNumber    string
+	PrNumber       string // Number of the pull request being built, empty for other builds
+	PrSourceBranch string // Branch the pull request comes from, f.e. feature/X
+	PrTargetBranch string // Branch the pull request is going to be merged into, f.e. main
+	Timestamp      string // UTC time of the build in the timestamp layout, f.e. 20191017101500
+	Dirty          bool   // Whether the git working tree has uncommitted changes
 }
 
 // Version is the representation of a processed version
@@ -39,20 +57,89 @@ func (v *Version) Execute(versionTemplate string) (string, error) {
 	return v.execute()
 }
 
+// Lists the fields referenced by the template, f.e. {{.Major}}.{{.Minor}} => Major, Minor.
+// Nil means the template may use any of the fields, f.e. when the whole metadata is passed to a function.
+func templateFields(versionTemplate string) (map[string]bool, error) {
+	t, err := template.New("version").Funcs(FuncMap).Parse(versionTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse version template: %v", err)
+	}
+
+	fields := map[string]bool{}
+	all := false
+	var visit func(node parse.Node)
+	visit = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, child := range n.Nodes {
+					visit(child)
+				}
+			}
+		case *parse.ActionNode:
+			visit(n.Pipe)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, cmd := range n.Cmds {
+					visit(cmd)
+				}
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				visit(arg)
+			}
+		case *parse.IfNode:
+			visit(n.Pipe)
+			visit(n.List)
+			visit(n.ElseList)
+		case *parse.RangeNode:
+			visit(n.Pipe)
+			visit(n.List)
+			visit(n.ElseList)
+		case *parse.WithNode:
+			visit(n.Pipe)
+			visit(n.List)
+			visit(n.ElseList)
+		case *parse.TemplateNode:
+			visit(n.Pipe)
+		case *parse.FieldNode:
+			fields[n.Ident[0]] = true
+		case *parse.VariableNode:
+			if n.Ident[0] == "$" && len(n.Ident) > 1 {
+				fields[n.Ident[1]] = true
+			} else if n.Ident[0] == "$" {
+				all = true // $ is the whole metadata
+			}
+		case *parse.ChainNode:
+			visit(n.Node)
+		case *parse.DotNode:
+			all = true
+		}
+	}
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			visit(tmpl.Tree.Root)
+		}
+	}
+
+	if all {
+		return nil, nil
+	}
+	return fields, nil
+}
+
 func (v *Version) execute() (string, error) {
 	var tpl bytes.Buffer
-	t := template.New("version")
+	t := template.New("version").Funcs(FuncMap)
 
 	t, err := t.Parse(v.template)
 	if err != nil {
-		log.Fatal("Parsing error: ", err)
-		return "", err
+		return "", fmt.Errorf("Failed to parse version template: %v", err)
 	}
 
 	err = t.Execute(&tpl, v.metadata)
 	if err != nil {
-		log.Fatal("Execution error: ", err)
-		return "", err
+		return "", fmt.Errorf("Failed to execute version template: %v", err)
 	}
 
 	return tpl.String(), nil
@@ -1,8 +1,10 @@
 package main
 
 import (
-	"gotest.tools/assert"
+	"errors"
 	"testing"
+
+	"gotest.tools/assert"
 )
 
 var VersionTests = []struct {
@@ -13,11 +15,77 @@ var VersionTests = []struct {
 	err      error
 }{
 	{"default", Metadata{Origin: "1.0.0"}, "{{.Origin}}", "1.0.0", nil},
+	{"components", Metadata{Major: 1, Minor: 2, Patch: 3, GitRef: "feature-x", BuildNumber: "13"}, "{{.Major}}.{{.Minor}}-{{.GitRef}}.{{.BuildNumber}}", "1.2-feature-x.13", nil},
+	{"conditional", Metadata{Version: "1.0.0", Dirty: true}, "{{.Version}}{{if .Dirty}}-dirty{{end}}", "1.0.0-dirty", nil},
+	{"parsing error", Metadata{}, "{{.Origin", "", errors.New("Failed to parse version template: template: version:1: unclosed action")},
+	{"execution error", Metadata{}, "{{.Unknown}}", "", errors.New("Failed to execute version template: template: version:1:2: executing \"version\" at <.Unknown>: can't evaluate field Unknown in type main.Metadata")},
 }
 
 func TestVersion(t *testing.T) {
 	for _, test := range VersionTests {
-		got, _ := New(test.metadata).Execute(test.template)
+		got, err := New(test.metadata).Execute(test.template)
 		assert.Equal(t, test.expected, got, "failed while testing "+test.name)
+		if test.err != nil {
+			assert.Error(t, err, test.err.Error(), "failed while testing "+test.name)
+		} else {
+			assert.NilError(t, err, "failed while testing "+test.name)
+		}
+	}
+}
+
+func TestTemplateFields(t *testing.T) {
+	var tests = []struct {
+		template string
+		expected map[string]bool
+	}{
+		{"{{.Major}}.{{.Minor}}", map[string]bool{"Major": true, "Minor": true}},
+		{"{{.GitBranch | slug | trunc 20}}.{{.GitSha | short 7}}", map[string]bool{"GitBranch": true, "GitSha": true}},
+		{"{{.Version}}{{if .Dirty}}-dirty{{else}}{{.Timestamp}}{{end}}", map[string]bool{"Version": true, "Dirty": true, "Timestamp": true}},
+		{"{{$sha := .GitSha}}{{$.Version}}-{{$sha}}", map[string]bool{"GitSha": true, "Version": true}},
+		{"{{with .GitTag}}{{.}}{{end}}", nil},
+		{"{{template \"x\" $}}{{define \"x\"}}{{.Major}}{{end}}", nil},
+		{"static", map[string]bool{}},
+	}
+
+	for _, test := range tests {
+		got, err := templateFields(test.template)
+		assert.NilError(t, err, "failed while testing "+test.template)
+		assert.DeepEqual(t, test.expected, got)
+	}
+
+	_, err := templateFields("{{.Origin")
+	assert.Error(t, err, "Failed to parse version template: template: version:1: unclosed action")
+}
+
+func TestCollectMetadataLazily(t *testing.T) {
+	resolveGitChanges = func() ([]GitChange, error) {
+		t.Fatal("working tree is scanned, while Dirty is not referenced")
+		return nil, nil
 	}
+	defer func() { resolveGitChanges = defaultGitChanges }()
+	openGitRepository = func() (*GitRepository, error) {
+		t.Fatal("repository is read, while no git field is referenced")
+		return nil, nil
+	}
+	defer func() { openGitRepository = defaultOpenGitRepository }()
+
+	fields, err := templateFields("{{.Major}}.{{.Minor}}-{{.GitRef}}")
+	assert.NilError(t, err)
+	metadata := collectMetadata(&Config{clock: "commit"}, "1.2.3", "feature/x", "1.2.3", fields)
+	assert.Equal(t, uint64(2), metadata.Minor)
+	assert.Equal(t, "feature-x", metadata.GitRef)
+}
+
+func TestCollectMetadataOfRelease(t *testing.T) {
+	fields := map[string]bool{"Prerelease": true, "Build": true}
+
+	metadata := collectMetadata(&Config{}, "1.2.3-rc.1+b7", "release/1.2.3", "1.2.3-rc.1+b7", fields)
+	assert.Equal(t, "rc.1", metadata.Prerelease)
+	assert.Equal(t, "b7", metadata.Build)
+
+	// The template can't bring the prerelease back into the release version
+	metadata = collectMetadata(&Config{release: true}, "1.2.3-rc.1+b7", "release/1.2.3", "1.2.3", fields)
+	assert.Equal(t, "", metadata.Prerelease)
+	assert.Equal(t, "", metadata.Build)
+	assert.Equal(t, uint64(3), metadata.Patch)
 }
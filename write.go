@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// VersionTargets contains the sources and the manifests the version can be written to by their names
+var VersionTargets = map[string]VersionWriter{}
+
+// RegisterVersionTarget makes the target available for writing
+func RegisterVersionTarget(name string, target VersionWriter) {
+	VersionTargets[name] = target
+}
+
+func init() {
+	RegisterVersionTarget("gradle", gradleSource{})
+	RegisterVersionTarget("maven", mavenSource{})
+	RegisterVersionTarget("npm", npmSource{})
+	RegisterVersionTarget("chart", chartTarget{})
+	RegisterVersionTarget("version-file", versionFileTarget{})
+}
+
+// Writes the version to the target, f.e. to the source it was resolved from. On dry run the diff is printed instead.
+func writeVersion(cfg *Config, target string, version string, diff io.Writer) error {
+	writer, found := VersionTargets[target]
+	if !found {
+		return fmt.Errorf("Failed to write version: %q doesn't support writing, available targets: %s", target, strings.Join(versionTargetNames(), ", "))
+	}
+	path, content, err := writer.Rewrite(cfg, version)
+	if err != nil {
+		return fmt.Errorf("Failed to write version to %s: %v", target, err)
+	}
+
+	if cfg.dryRun {
+		original, _ := ioutil.ReadFile(path) // new files are diffed against the empty ones
+		_, err := io.WriteString(diff, unifiedDiff(path, string(original), string(content)))
+		return err
+	}
+	if err := writeFileKeepingMode(path, content); err != nil {
+		return fmt.Errorf("Failed to write version to %s: %v", target, err)
+	}
+	return nil
+}
+
+func versionTargetNames() []string {
+	names := make([]string, 0, len(VersionTargets))
+	for name := range VersionTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateWriteTargets(targets []string) error {
+	for _, target := range targets {
+		if _, found := VersionTargets[target]; !found {
+			return fmt.Errorf("Unknown write target %q, available targets: %s", target, strings.Join(versionTargetNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// Writes the version into the Helm chart, Chart.yaml by default
+type chartTarget struct{}
+
+// Top-level version and appVersion of Chart.yaml, keeping the quotes and the comment of the line
+var chartVersionLine = regexp.MustCompile(`(?m)^(version|appVersion):([ \t]*)("[^"\n]*"|'[^'\n]*'|[^\s#]*)`)
+
+func (chartTarget) Rewrite(cfg *Config, version string) (string, []byte, error) {
+	path := valueOr(cfg.chart, ChartFlag.Value)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return path, nil, err
+	}
+
+	found := false
+	updated := chartVersionLine.ReplaceAllFunc(content, func(line []byte) []byte {
+		m := chartVersionLine.FindSubmatch(line)
+		key, space, old := string(m[1]), string(m[2]), string(m[3])
+		if key == "version" {
+			found = true
+		}
+		if len(space) == 0 {
+			space = " "
+		}
+		quote := ""
+		if strings.HasPrefix(old, `"`) || strings.HasPrefix(old, "'") {
+			quote = old[:1]
+		}
+		return []byte(key + ":" + space + quote + version + quote)
+	})
+	if !found {
+		return path, nil, fmt.Errorf("%s has no version", path)
+	}
+	return path, updated, nil
+}
+
+// Writes the version into the plain text file, VERSION by default
+type versionFileTarget struct{}
+
+func (versionFileTarget) Rewrite(cfg *Config, version string) (string, []byte, error) {
+	path := valueOr(cfg.versionFile, VersionFileFlag.Value)
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return path, nil, err
+	}
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		return path, []byte(version), nil
+	}
+	return path, []byte(version + "\n"), nil
+}
+
+// Replaces the value of the property in place, keeping comments, ordering and formatting of the rest of the file.
+// The property is appended, if the file doesn't declare it yet.
+func rewritePropertiesFile(filename string, key string, value string) ([]byte, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	found := false
+	for i, line := range lines {
+		equal := strings.Index(line, "=")
+		if equal < 0 || strings.TrimSpace(line[:equal]) != key {
+			continue
+		}
+		body := strings.TrimRight(line, "\r\n")
+		rest := line[equal+1:]
+		lines[i] = line[:equal+1] + rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))] + value + line[len(body):]
+		found = true
+	}
+
+	updated := strings.Join(lines, "")
+	if !found {
+		if len(updated) > 0 && !strings.HasSuffix(updated, "\n") {
+			updated += "\n"
+		}
+		updated += key + "=" + value + "\n"
+	}
+	return []byte(updated), nil
+}
+
+// Replaces the content between the offsets, keeping the whitespace around the replaced value
+func replaceTrimmed(content []byte, start int, end int, value string) []byte {
+	old := string(content[start:end])
+	start += len(old) - len(strings.TrimLeft(old, " \t\r\n"))
+	end -= len(old) - len(strings.TrimRight(old, " \t\r\n"))
+	if end < start {
+		end = start
+	}
+
+	var updated []byte
+	updated = append(updated, content[:start]...)
+	updated = append(updated, value...)
+	return append(updated, content[end:]...)
+}
+
+// Overwrites the file, keeping its permissions
+func writeFileKeepingMode(filename string, content []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode()
+	}
+	return ioutil.WriteFile(filename, content, mode)
+}
+
+// Renders the unified diff of the file. Version changes are local, so the single hunk with 3 lines of context is enough.
+func unifiedDiff(path string, original string, updated string) string {
+	if original == updated {
+		return ""
+	}
+	a, b := splitLines(original), splitLines(updated)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	start := prefix - 3
+	if start < 0 {
+		start = 0
+	}
+	context := suffix
+	if context > 3 {
+		context = 3
+	}
+	aEnd, bEnd := len(a)-suffix+context, len(b)-suffix+context
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n@@ -%s +%s @@\n", path, path, hunkRange(start, aEnd-start), hunkRange(start, bEnd-start))
+	writeLines := func(mark string, lines []string) {
+		for _, line := range lines {
+			out.WriteString(mark + line)
+			if !strings.HasSuffix(line, "\n") {
+				// The last line of the file, patch and git apply need the marker to keep it without the line ending
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	writeLines(" ", a[start:prefix])
+	writeLines("-", a[prefix:len(a)-suffix])
+	writeLines("+", b[prefix:len(b)-suffix])
+	writeLines(" ", a[len(a)-suffix:aEnd])
+	return out.String()
+}
+
+// Splits the content into lines, keeping the line endings
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Formats the line range of the hunk, f.e. 2,7 (7 lines starting from the 2nd one) or 0,0 (empty file)
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestWriteVersion(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	assert.NilError(t, os.Chdir(dir))
+
+	var tests = []struct {
+		name     string
+		config   Config
+		source   string
+		file     string
+		content  string
+		expected string
+		err      string
+	}{
+		{"gradle", Config{}, "gradle", "gradle.properties",
+			"# release\r\ngroup=com.example\nversion = 1.2.3-SNAPSHOT\r\n\nname=app",
+			"# release\r\ngroup=com.example\nversion = 1.3.0\r\n\nname=app", ""},
+		{"gradle: no version", Config{gradle: "app.properties"}, "gradle", "app.properties",
+			"name=app",
+			"name=app\nversion=1.3.0\n", ""},
+		{"npm", Config{}, "npm", "package.json",
+			"{\n  \"name\": \"app\",\n  \"config\": {\"version\": \"0.1.0\"},\n  \"version\" : \"1.2.3\",\n  \"private\": true\n}\n",
+			"{\n  \"name\": \"app\",\n  \"config\": {\"version\": \"0.1.0\"},\n  \"version\" : \"1.3.0\",\n  \"private\": true\n}\n", ""},
+		{"npm: workspace", Config{npm: "ws", npmWorkspace: "@app/api"}, "npm", "ws/packages/api/package.json",
+			`{"name": "@app/api", "version": "1.2.3"}`,
+			`{"name": "@app/api", "version": "1.3.0"}`, ""},
+		{"npm: no version", Config{npm: "empty.json"}, "npm", "empty.json",
+			`{"name": "app", "dependencies": {"version": "1.0.0"}}`,
+			"", "Failed to write version to npm: empty.json has no version"},
+		{"maven", Config{}, "maven", "pom.xml",
+			"<project>\n  <parent><version>1.0.0</version></parent>\n  <!-- <version>0.0.1</version> -->\n  <version>\n    1.2.3-SNAPSHOT\n  </version>\n</project>\n",
+			"<project>\n  <parent><version>1.0.0</version></parent>\n  <!-- <version>0.0.1</version> -->\n  <version>\n    1.3.0\n  </version>\n</project>\n", ""},
+		{"maven: property", Config{maven: "revision"}, "maven", "revision/pom.xml",
+			"<project><version>${revision}</version><properties><revision>1.2.3</revision></properties></project>",
+			"<project><version>${revision}</version><properties><revision>1.3.0</revision></properties></project>", ""},
+		{"maven: inherited", Config{maven: "child.xml"}, "maven", "child.xml",
+			"<project><parent><version>1.2.3</version></parent></project>",
+			"", "Failed to write version to maven: child.xml inherits the version from the parent, update the parent instead"},
+		{"maven: expression", Config{maven: "expr.xml"}, "maven", "expr.xml",
+			"<project><version>${major}.2.3</version><properties><major>1</major></properties></project>",
+			"", "Failed to write version to maven: expr.xml: version ${major}.2.3 is an expression and can't be updated"},
+		{"chart", Config{}, "chart", "Chart.yaml",
+			"apiVersion: v2\nname: app\nversion: 1.2.3 # chart\nappVersion: \"1.2.3\"\ndependencies:\n  - name: db\n    version: 1.0.0\n",
+			"apiVersion: v2\nname: app\nversion: 1.3.0 # chart\nappVersion: \"1.3.0\"\ndependencies:\n  - name: db\n    version: 1.0.0\n", ""},
+		{"chart: no version", Config{chart: "charts/Chart.yaml"}, "chart", "charts/Chart.yaml",
+			"name: app\n",
+			"", "Failed to write version to chart: charts/Chart.yaml has no version"},
+		{"version-file", Config{}, "version-file", "VERSION",
+			"1.2.3\n",
+			"1.3.0\n", ""},
+		{"version-file: no newline", Config{versionFile: "app.version"}, "version-file", "app.version",
+			"1.2.3",
+			"1.3.0", ""},
+		{"version-file: new", Config{versionFile: "new.version"}, "version-file", "",
+			"",
+			"1.3.0\n", ""},
+		{"env", Config{}, "env", "", "", "", "Failed to write version: \"env\" doesn't support writing, available targets: chart, gradle, maven, npm, version-file"},
+		{"git-tag", Config{}, "git-tag", "", "", "", "Failed to write version: \"git-tag\" doesn't support writing, available targets: chart, gradle, maven, npm, version-file"},
+	}
+
+	writeFile(t, filepath.Join(dir, "ws", "package.json"), `{"workspaces": ["packages/*"]}`)
+	for _, test := range tests {
+		if len(test.file) > 0 {
+			writeFile(t, filepath.Join(dir, test.file), test.content)
+		}
+		err := writeVersion(&test.config, test.source, "1.3.0", ioutil.Discard)
+		if len(test.err) > 0 {
+			assert.Error(t, err, test.err, "failed while testing "+test.name)
+			continue
+		}
+		assert.NilError(t, err, "failed while testing "+test.name)
+
+		path, _, _ := VersionTargets[test.source].Rewrite(&test.config, "1.3.0")
+		content, err := ioutil.ReadFile(path)
+		assert.NilError(t, err)
+		assert.Equal(t, test.expected, string(content), "failed while testing "+test.name)
+
+		if _, found := VersionSources[test.source]; !found {
+			continue
+		}
+		got, source, err := resolveVersion(&Config{source: test.source, gradle: test.config.gradle, npm: test.config.npm, npmWorkspace: test.config.npmWorkspace, maven: test.config.maven})
+		assert.NilError(t, err, "failed while testing "+test.name)
+		assert.Equal(t, "1.3.0", got, "failed while testing "+test.name)
+		assert.Equal(t, test.source, source, "failed while testing "+test.name)
+	}
+}
+
+func TestWriteVersionDryRun(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	assert.NilError(t, os.Chdir(dir))
+
+	properties := "# release\ngroup=com.example\nname=app\ndescription=app\nversion=1.2.3-SNAPSHOT\nkotlin=1.3\njava=11\nscala=2.13\nrust=1.38\n"
+	writeFile(t, "gradle.properties", properties)
+
+	var diff bytes.Buffer
+	config := Config{dryRun: true}
+	assert.NilError(t, writeVersion(&config, "gradle", "1.3.0", &diff))
+	assert.NilError(t, writeVersion(&config, "version-file", "1.3.0", &diff))
+	assert.Equal(t, `--- gradle.properties
++++ gradle.properties
+@@ -2,7 +2,7 @@
+ group=com.example
+ name=app
+ description=app
+-version=1.2.3-SNAPSHOT
++version=1.3.0
+ kotlin=1.3
+ java=11
+ scala=2.13
+--- VERSION
++++ VERSION
+@@ -0,0 +1,1 @@
++1.3.0
+`, diff.String())
+
+	content, err := ioutil.ReadFile("gradle.properties")
+	assert.NilError(t, err)
+	assert.Equal(t, properties, string(content), "dry run doesn't write")
+	_, err = os.Stat("VERSION")
+	assert.Assert(t, os.IsNotExist(err), "dry run doesn't create")
+
+	assert.Equal(t, "", unifiedDiff("VERSION", "1.3.0\n", "1.3.0\n"))
+	assert.Equal(t, "--- VERSION\n+++ VERSION\n@@ -1,1 +1,1 @@\n-1.2.3\n\\ No newline at end of file\n+1.3.0\n\\ No newline at end of file\n", unifiedDiff("VERSION", "1.2.3", "1.3.0"))
+	assert.Equal(t, "--- VERSION\n+++ VERSION\n@@ -1,1 +1,1 @@\n-1.2.3\n\\ No newline at end of file\n+1.3.0\n", unifiedDiff("VERSION", "1.2.3", "1.3.0\n"))
+
+	assert.NilError(t, validateWriteTargets([]string{"gradle", "chart"}))
+	assert.Error(t, validateWriteTargets([]string{"env"}), "Unknown write target \"env\", available targets: chart, gradle, maven, npm, version-file")
+}
+
+func TestUnifiedDiffApplies(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	var tests = []struct {
+		original string
+		updated  string
+	}{
+		{"1.2.3", "1.3.0"},
+		{"1.2.3\n", "1.3.0"},
+		{"1.2.3", "1.3.0\n"},
+		{"a\nb\nc\nd\nversion=1.2.3\ne", "a\nb\nc\nd\nversion=1.3.0\ne"},
+		{"version=1.2.3\na\nb\nc\nd\ne", "version=1.3.0\na\nb\nc\nd\ne\n"},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join(dir, "VERSION")
+		writeFile(t, file, test.original)
+		writeFile(t, filepath.Join(dir, "version.patch"), unifiedDiff("VERSION", test.original, test.updated))
+		runGit(t, dir, "apply", "-p0", "version.patch")
+
+		content, err := ioutil.ReadFile(file)
+		assert.NilError(t, err)
+		assert.Equal(t, test.updated, string(content), "failed while testing %q", test.original)
+	}
+}